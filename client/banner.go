@@ -0,0 +1,30 @@
+package nntpclient
+
+import (
+	"regexp"
+)
+
+// Banner patterns for some common servers.  Each captures the version.
+var serverBanners = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"INN", regexp.MustCompile(`\bINN (\d[\w.-]*)`)},
+	{"Diablo", regexp.MustCompile(`(?i)\bDiablo (\d[\w.-]*)`)},
+	{"Cyclone", regexp.MustCompile(`(?i)\bCyclone(?:/| )(\d[\w.-]*)`)},
+	{"Typhoon", regexp.MustCompile(`(?i)\bTyphoon(?:/| )(\d[\w.-]*)`)},
+	{"Leafnode", regexp.MustCompile(`(?i)\bLeafnode (?:NNTP Daemon, )?v?(\d[\w.-]*)`)},
+	{"DNews", regexp.MustCompile(`(?i)\bDNews (?:Version )?(\d[\w.-]*)`)},
+	{"Highwind", regexp.MustCompile(`(?i)\bHighwind (?:\w+ )?(\d[\w.-]*)`)},
+}
+
+// ServerSoftware makes a best guess at the server software and version
+// from the connection banner.  ok is false if it isn't recognized.
+func (c *Client) ServerSoftware() (name, version string, ok bool) {
+	for _, b := range serverBanners {
+		if m := b.re.FindStringSubmatch(c.Banner); m != nil {
+			return b.name, m[1], true
+		}
+	}
+	return "", "", false
+}
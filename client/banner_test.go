@@ -0,0 +1,32 @@
+package nntpclient
+
+import (
+	"testing"
+)
+
+func TestServerSoftware(t *testing.T) {
+	tests := []struct {
+		banner, name, version string
+	}{
+		{"news.example.com InterNetNews server INN 2.6.3 ready (transit mode)",
+			"INN", "2.6.3"},
+		{"news.example.com InterNetNews NNRP server INN 2.7.0rc1 ready (posting ok)",
+			"INN", "2.7.0rc1"},
+		{"feed.example.net Diablo 5.1-REL ready", "Diablo", "5.1-REL"},
+		{"news.example.org Cyclone/2.1.3 NNTP server ready", "Cyclone", "2.1.3"},
+		{"Leafnode NNTP Daemon, v2.0.0.alpha20140727b running at localhost",
+			"Leafnode", "2.0.0.alpha20140727b"},
+	}
+	for _, test := range tests {
+		c := &Client{Banner: test.banner}
+		name, version, ok := c.ServerSoftware()
+		if !ok || name != test.name || version != test.version {
+			t.Errorf("%q: got %q %q %v", test.banner, name, version, ok)
+		}
+	}
+
+	c := &Client{Banner: "news.example.com ready"}
+	if _, _, ok := c.ServerSoftware(); ok {
+		t.Error("Expected an unknown banner not to be recognized")
+	}
+}
@@ -0,0 +1,178 @@
+package nntpclient
+
+import (
+	"bytes"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// foldWidth is the line length headers are folded to (RFC 5322 section
+// 2.1.1).
+const foldWidth = 78
+
+// An ArticleBuilder assembles an article for posting with PostArticle.
+// Headers are written in the order they were first set.
+type ArticleBuilder struct {
+	header textproto.MIMEHeader
+	order  []string
+	body   string
+}
+
+// NewArticleBuilder starts an article with the headers every post
+// needs.
+func NewArticleBuilder(from, subject string, newsgroups ...string) *ArticleBuilder {
+	b := &ArticleBuilder{header: make(textproto.MIMEHeader)}
+	b.Set("From", from)
+	b.Set("Newsgroups", strings.Join(newsgroups, ","))
+	b.Set("Subject", subject)
+	return b
+}
+
+// Set a header, replacing any previous value.  Line breaks in the
+// value are replaced by spaces.
+func (b *ArticleBuilder) Set(name, value string) {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if _, ok := b.header[name]; !ok {
+		b.order = append(b.order, name)
+	}
+	value = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+	b.header.Set(name, value)
+}
+
+// Get returns a header's value, or "" if it isn't set.
+func (b *ArticleBuilder) Get(name string) string {
+	return b.header.Get(name)
+}
+
+// SetOrganization sets the Organization header.
+func (b *ArticleBuilder) SetOrganization(org string) {
+	b.Set("Organization", org)
+}
+
+// SetUserAgent sets the User-Agent header.
+func (b *ArticleBuilder) SetUserAgent(ua string) {
+	b.Set("User-Agent", ua)
+}
+
+// SetReplyTo sets the Reply-To header.
+func (b *ArticleBuilder) SetReplyTo(addr string) {
+	b.Set("Reply-To", addr)
+}
+
+// SetReferences sets the References header from the message-ids of the
+// thread, oldest first.  Replies without it are refused by some
+// servers.
+func (b *ArticleBuilder) SetReferences(ids []string) {
+	b.Set("References", strings.Join(ids, " "))
+}
+
+// SetDistribution sets the Distribution header.
+func (b *ArticleBuilder) SetDistribution(dist string) {
+	b.Set("Distribution", dist)
+}
+
+// SetBody sets the article body.
+func (b *ArticleBuilder) SetBody(body string) {
+	b.body = body
+}
+
+// foldHeader formats a header line, folding it so no line is longer
+// than foldWidth where that's possible.  Folding only inserts CRLF
+// before whitespace already in the value, so unfolding gives back the
+// value exactly; a value with nowhere to fold is left long.
+func foldHeader(name, value string) string {
+	var sb strings.Builder
+	line := name + ":"
+	if value != "" {
+		line += " " + value
+	}
+	// Only break once a line has something other than whitespace.
+	start := len(name) + 1
+	for len(line) > foldWidth {
+		i := foldPoint(line, start)
+		if i < 0 {
+			break
+		}
+		sb.WriteString(line[:i])
+		sb.WriteString("\r\n")
+		line = line[i:]
+		start = 0
+	}
+	sb.WriteString(line)
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+func isWSP(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+// foldPoint finds where to fold line: the latest run of whitespace
+// that keeps it within foldWidth, or failing that the earliest one.
+// There must be something other than whitespace after start before
+// the fold and after it.  It returns -1 if there's no such place.
+func foldPoint(line string, start int) int {
+	first := start
+	for first < len(line) && isWSP(line[first]) {
+		first++
+	}
+	last := len(line) - 1
+	for last > first && isWSP(line[last]) {
+		last--
+	}
+	j := -1
+	for i := first + 1; i < last; i++ {
+		if !isWSP(line[i]) || isWSP(line[i-1]) {
+			continue
+		}
+		if i > foldWidth && j >= 0 {
+			break
+		}
+		j = i
+		if i > foldWidth {
+			break
+		}
+	}
+	return j
+}
+
+// WriteTo writes the article, with CRLF line endings, to w.
+func (b *ArticleBuilder) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, name := range b.order {
+		for _, v := range b.header[name] {
+			buf.WriteString(foldHeader(name, v))
+		}
+	}
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(b.body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.WriteTo(w)
+}
+
+// PostArticle posts a built article, returning its message-id.
+//
+// A Date header is added from the client's clock (see SetClock) and a
+// Message-ID generated if they aren't already set.  The Message-ID is
+// in the configured MessageIDDomain, or else the From address's
+// domain.
+func (c *Client) PostArticle(b *ArticleBuilder) (string, error) {
+	if b.Get("Date") == "" {
+		b.Set("Date", c.clock().Format(time.RFC1123Z))
+	}
+	if b.Get("Message-Id") == "" {
+		domain, err := c.messageIDDomain(b.Get("From"))
+		if err != nil {
+			return "", err
+		}
+		b.Set("Message-Id", newMessageID(domain))
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return "", err
+	}
+	id := b.Get("Message-Id")
+	return id, c.Post(&buf)
+}
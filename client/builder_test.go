@@ -0,0 +1,178 @@
+package nntpclient
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArticleBuilderHeaders(t *testing.T) {
+	b := NewArticleBuilder("me@example.com", "Re: hello", "misc.test", "alt.test")
+	b.SetOrganization("Example Org")
+	b.SetUserAgent("go-nntp")
+	b.SetReplyTo("replies@example.com")
+	b.SetDistribution("local")
+	b.SetBody("line one\nline two\n")
+
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "From: me@example.com\r\n" +
+		"Newsgroups: misc.test,alt.test\r\n" +
+		"Subject: Re: hello\r\n" +
+		"Organization: Example Org\r\n" +
+		"User-Agent: go-nntp\r\n" +
+		"Reply-To: replies@example.com\r\n" +
+		"Distribution: local\r\n" +
+		"\r\n" +
+		"line one\r\nline two\r\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%q\ngot:\n%q", want, buf.String())
+	}
+}
+
+func TestArticleBuilderFoldsReferences(t *testing.T) {
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("<%d.reference@news.example.com>", 1000000+i))
+	}
+	b := NewArticleBuilder("me@example.com", "Re: long thread", "misc.test")
+	b.SetReferences(ids)
+
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	head := strings.SplitN(buf.String(), "\r\n\r\n", 2)[0]
+	lines := strings.Split(head, "\r\n")
+	var refs []string
+	for i, line := range lines {
+		if len(line) > foldWidth {
+			t.Errorf("Line %v is %v long: %q", i, len(line), line)
+		}
+		if strings.HasPrefix(line, "References:") {
+			refs = append(refs, strings.TrimPrefix(line, "References:"))
+		} else if len(refs) > 0 && strings.HasPrefix(line, " ") {
+			refs = append(refs, line)
+		}
+	}
+	if len(refs) < 2 {
+		t.Fatalf("Expected References to be folded, got %q", lines)
+	}
+	if got := strings.Fields(strings.Join(refs, "")); strings.Join(got, " ") != strings.Join(ids, " ") {
+		t.Errorf("Unfolded references don't match: %q", got)
+	}
+}
+
+func TestFoldHeaderKeepsWhitespace(t *testing.T) {
+	if got := foldHeader("Subject", "a  b\tc   [1/2]"); got != "Subject: a  b\tc   [1/2]\r\n" {
+		t.Errorf("Short header changed: %q", got)
+	}
+
+	value := strings.Repeat("word  \tword ", 12) + "[01/10]"
+	got := foldHeader("Subject", value)
+	lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected a folded header, got %q", got)
+	}
+	for i, line := range lines {
+		if len(line) > foldWidth || strings.TrimSpace(line) == "" {
+			t.Errorf("Bad line %v: %q", i, line)
+		}
+	}
+	if unfolded := strings.Join(lines, ""); unfolded != "Subject: "+value {
+		t.Errorf("Unfolded header doesn't match:\n%q", unfolded)
+	}
+
+	long := strings.Repeat("x", 100)
+	if got := foldHeader("Subject", long); got != "Subject: "+long+"\r\n" {
+		t.Errorf("Unfoldable header changed: %q", got)
+	}
+}
+
+func TestPostArticle(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.SetClock(func() time.Time {
+		return time.Date(2019, 1, 3, 18, 58, 44, 0, time.UTC)
+	})
+
+	b := NewArticleBuilder("Me <me@example.com>", "hello", "misc.test")
+	b.SetBody("hi\n")
+	id, err := cli.PostArticle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !validMessageID(id) || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Unexpected message-id %q", id)
+	}
+	art := stub.receivedArticles[0]
+	for _, want := range []string{
+		"Date: Thu, 03 Jan 2019 18:58:44 +0000\r\n",
+		"Message-Id: " + id + "\r\n",
+	} {
+		if !strings.Contains(art, want) {
+			t.Errorf("Expected %q in:\n%s", want, art)
+		}
+	}
+}
+
+func TestPostArticleMessageIDDomain(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	for i := 0; i < 100; i++ {
+		stub.PrepareResponse("POST", 340, "Send article")
+		stub.PrepareResponse("POST", 240, "Article received OK")
+	}
+	cli, err := NewConnWithConfig(stub, Config{MessageIDDomain: "news.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		b := NewArticleBuilder("me@example.com", "hello", "misc.test")
+		id, err := cli.PostArticle(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !validMessageID(id) || !strings.HasSuffix(id, "@news.example.org>") {
+			t.Fatalf("Unexpected message-id %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Message-id %q generated twice", id)
+		}
+		seen[id] = true
+	}
+
+	for _, domain := range []string{"bad domain", "a..b", "x>y", "é.example"} {
+		cli, err := NewConnWithConfig(NewStub(200, "Stub"), Config{MessageIDDomain: domain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cli.PostArticle(NewArticleBuilder("me@example.com", "hello", "misc.test")); err == nil {
+			t.Errorf("Expected domain %q to be refused", domain)
+		}
+	}
+
+	for _, from := range []string{"me@example.com (Me Myself)", "Me Myself <me@example.com>"} {
+		stub := NewStub(200, "Stub")
+		stub.PrepareResponse("POST", 340, "Send article")
+		stub.PrepareResponse("POST", 240, "Article received OK")
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := cli.PostArticle(NewArticleBuilder(from, "hello", "misc.test"))
+		if err != nil || !strings.HasSuffix(id, "@example.com>") {
+			t.Errorf("From %q: unexpected message-id %q, %v", from, id, err)
+		}
+	}
+}
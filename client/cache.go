@@ -0,0 +1,111 @@
+package nntpclient
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/knothon/go-nntp"
+)
+
+type overviewKey struct {
+	group     string
+	low, high int64
+}
+
+type overviewEntry struct {
+	key     overviewKey
+	v       []*nntp.ArticleOverview
+	fetched time.Time
+}
+
+// overviewCache is a least recently used cache of overview results.
+type overviewCache struct {
+	max   int
+	ttl   time.Duration
+	order *list.List
+	items map[overviewKey]*list.Element
+	// The high watermark last seen for each cached group.
+	highs map[string]int64
+}
+
+// EnableOverviewCache caches the results of Over and XOver for closed
+// ranges within the selected group.
+//
+// Up to maxEntries results are kept, each for at most ttl, or until
+// evicted if ttl is zero or negative.  A group's entries are dropped
+// when selecting it (with GROUP or LISTGROUP) shows new articles.
+// Cached results share their ArticleOverview values, which shouldn't
+// be modified.  A maxEntries below 1 disables the cache.
+func (c *Client) EnableOverviewCache(maxEntries int, ttl time.Duration) {
+	if maxEntries < 1 {
+		c.overCache = nil
+		return
+	}
+	c.overCache = &overviewCache{
+		max:   maxEntries,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[overviewKey]*list.Element),
+		highs: make(map[string]int64),
+	}
+}
+
+func (oc *overviewCache) get(k overviewKey, now time.Time) ([]*nntp.ArticleOverview, bool) {
+	el, ok := oc.items[k]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*overviewEntry)
+	if oc.ttl > 0 && now.Sub(e.fetched) > oc.ttl {
+		oc.remove(el)
+		return nil, false
+	}
+	oc.order.MoveToFront(el)
+	return append([]*nntp.ArticleOverview(nil), e.v...), true
+}
+
+func (oc *overviewCache) put(k overviewKey, v []*nntp.ArticleOverview, now time.Time) {
+	if el, ok := oc.items[k]; ok {
+		oc.remove(el)
+	}
+	oc.items[k] = oc.order.PushFront(&overviewEntry{k, v, now})
+	for oc.order.Len() > oc.max {
+		oc.remove(oc.order.Back())
+	}
+}
+
+func (oc *overviewCache) remove(el *list.Element) {
+	delete(oc.items, el.Value.(*overviewEntry).key)
+	oc.order.Remove(el)
+}
+
+// observe records a group's high watermark, dropping the group's
+// entries if it has moved on.
+func (oc *overviewCache) observe(group string, high int64) {
+	if old, ok := oc.highs[group]; ok && high > old {
+		for el := oc.order.Front(); el != nil; {
+			next := el.Next()
+			if el.Value.(*overviewEntry).key.group == group {
+				oc.remove(el)
+			}
+			el = next
+		}
+	}
+	oc.highs[group] = high
+}
+
+// cachedOverview fetches an overview through the cache, if enabled.
+func (c *Client) cachedOverview(verb string, r Range, format []overviewField) ([]*nntp.ArticleOverview, error) {
+	if c.overCache == nil || r.Open() || c.group == "" {
+		return c.overview(verb, r.String(), format)
+	}
+	k := overviewKey{c.group, r.Low, r.High}
+	if v, ok := c.overCache.get(k, c.clock()); ok {
+		return v, nil
+	}
+	v, err := c.overview(verb, r.String(), format)
+	if err == nil {
+		c.overCache.put(k, v, c.clock())
+	}
+	return v, err
+}
@@ -0,0 +1,124 @@
+package nntpclient
+
+import (
+	"testing"
+	"time"
+)
+
+func cacheStub() *stubReaderWriter {
+	stub := overBenchStub(3)
+	stub.PrepareResponse("GROUP", 211, "3 0 2 misc.test")
+	stub.PrepareResponse("GROUP", 211, "4 0 3 misc.test")
+	return stub
+}
+
+func TestOverviewCacheHitAndExpiry(t *testing.T) {
+	stub := cacheStub()
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 1, 3, 18, 0, 0, 0, time.UTC)
+	cli.SetClock(func() time.Time { return now })
+	cli.EnableOverviewCache(10, time.Minute)
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := cli.Over(0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != 3 {
+			t.Fatalf("Expected 3 articles, got %v", len(v))
+		}
+	}
+	if n := CountReceivedRequests(stub, "OVER"); n != 1 {
+		t.Fatalf("Expected a cache hit, got %v OVER requests", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "OVER"); n != 2 {
+		t.Fatalf("Expected the entry to expire, got %v OVER requests", n)
+	}
+}
+
+func TestOverviewCacheInvalidatedByNewArticles(t *testing.T) {
+	stub := cacheStub()
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.EnableOverviewCache(10, time.Hour)
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The high watermark moves from 2 to 3.
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "OVER"); n != 2 {
+		t.Fatalf("Expected the group's entries to be dropped, got %v OVER requests", n)
+	}
+}
+
+func TestOverviewCacheWithoutExpiry(t *testing.T) {
+	stub := cacheStub()
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 1, 3, 18, 0, 0, 0, time.UTC)
+	cli.SetClock(func() time.Time { return now })
+	cli.EnableOverviewCache(10, 0)
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(24 * time.Hour)
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "OVER"); n != 1 {
+		t.Fatalf("Expected a zero ttl to keep entries, got %v OVER requests", n)
+	}
+}
+
+func TestOverviewCacheInvalidatedByListGroup(t *testing.T) {
+	stub := cacheStub()
+	stub.PrepareDotPayloadResponse("LISTGROUP", 211, "4 0 3 misc.test", "0", "1", "2", "3")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.EnableOverviewCache(10, time.Hour)
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.ListGroupRange("misc.test", Range{0, -1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "OVER"); n != 2 {
+		t.Fatalf("Expected LISTGROUP to drop the group's entries, got %v OVER requests", n)
+	}
+}
@@ -2,12 +2,21 @@
 package nntpclient
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"io"
+	"math"
+	"net"
+	"net/mail"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"fmt"
 	"time"
@@ -30,89 +39,513 @@ const (
 
 // Client is an NNTP client.
 type Client struct {
-	conn               *textproto.Conn
-	overViewFormat     []OverHeader
+	connection
+	config Config
+	// Reopens the connection; nil for clients made with NewConn.
+	dial func() (io.ReadWriteCloser, error)
+
+	// The session set up on the connection, which reconnect (via
+	// restoreSession) sets up again on the new one.
+
+	// The settings given to StartTLS.
+	tlsConfig *tls.Config
+	// Credentials for AutoReauth.
+	user, pass string
+	// The last group successfully selected.
+	group string
+
+	// Overview results, if caching is enabled.
+	overCache *overviewCache
+	// The clock for generated dates; time.Now if nil.
+	now    func() time.Time
+	Banner string
+	// PostingAllowed is set from the banner (200 vs. 201) and updated
+	// from the POST capability after authenticating.
+	PostingAllowed bool
+}
+
+// connection is the client state tied to one connection, all of which
+// is replaced when the client reconnects.
+type connection struct {
+	conn *textproto.Conn
+	// The connection underneath conn, before any compression.
+	rwc                io.ReadWriteCloser
+	compressed         bool
+	overViewFormat     []overviewField
 	capabilities       []string
 	loadedCapabilities bool
-	Banner             string
+	// The current article number within group; 0 if there's none.
+	article   int64
+	closed    bool
+	reauthing bool
+	// The reader of the last article response, for DrainArticle.
+	body io.Reader
 }
 
-// New connects a client to an NNTP server.
-func New(net, addr string) (*Client, error) {
-	conn, err := textproto.Dial(net, addr)
-	if err != nil {
-		return nil, err
+// Config holds optional client settings.  The zero value gives the
+// behavior of New, NewSsl and NewConn.
+type Config struct {
+	// ConnectTimeout bounds the wait for the server's banner once
+	// connected.  Zero waits forever.
+	ConnectTimeout time.Duration
+	// ReadBufferSize and WriteBufferSize set the size of the buffers
+	// between the connection and the protocol reader and writer.
+	// Zero uses textproto's defaults (4KB).
+	ReadBufferSize  int
+	WriteBufferSize int
+	// AutoReauth keeps the credentials given to Authenticate so that
+	// a command refused with 480 (authentication required), as when
+	// a session expires, can authenticate again and be retried.
+	AutoReauth bool
+	// MaxLineBytes limits the length of lines in multi-line responses
+	// other than articles, such as lists and overviews, not counting
+	// the line ending.  Longer lines
+	// are skipped and the read fails with ErrLineTooLong once the rest
+	// of the response is consumed.  Zero means no limit.
+	MaxLineBytes int
+	// SplitXRefHost moves the server name at the start of overview
+	// Xref fields into XRefHost, leaving XRef as just the group:number
+	// pairs.  These are then comparable across servers.
+	SplitXRefHost bool
+	// DetectDuplicateIDs makes PostMany and StreamUploader refuse an
+	// article whose Message-ID already appeared earlier in the batch,
+	// with a *DuplicateMessageIDError, rather than sending it for the
+	// server to quietly drop.
+	DetectDuplicateIDs bool
+	// MessageIDDomain is the domain used in generated Message-IDs, such
+	// as by PostArticle.  If empty, the domain of the From address is
+	// used.  Servers may refuse ids in a domain that isn't plausibly
+	// the poster's.
+	MessageIDDomain string
+}
+
+// newTextprotoConn wraps rwc for the protocol, using the configured
+// buffer sizes.
+func newTextprotoConn(rwc io.ReadWriteCloser, cfg Config) *textproto.Conn {
+	conn := textproto.NewConn(rwc)
+	if cfg.ReadBufferSize > 0 {
+		conn.Reader = *textproto.NewReader(bufio.NewReaderSize(rwc, cfg.ReadBufferSize))
 	}
+	if cfg.WriteBufferSize > 0 {
+		conn.Writer = *textproto.NewWriter(bufio.NewWriterSize(rwc, cfg.WriteBufferSize))
+	}
+	return conn
+}
+
+// ErrBannerTimeout is returned when the server doesn't send its banner
+// within the configured ConnectTimeout.
+var ErrBannerTimeout = errors.New("timed out waiting for server banner")
+
+// New connects a client to an NNTP server.
+func New(network, addr string) (*Client, error) {
+	return NewWithConfig(network, addr, Config{})
+}
 
-	return connect(conn)
+// NewWithConfig connects a client to an NNTP server with the given
+// settings.
+func NewWithConfig(network, addr string, cfg Config) (*Client, error) {
+	return dialClient(func() (io.ReadWriteCloser, error) {
+		return net.Dial(network, addr)
+	}, cfg)
 }
 
 // New connects a client to an NNTP server using tls
 func NewSsl(net string, add string, tlsConfig *tls.Config) (*Client, error) {
-	conn, err := tls.Dial(net, add, tlsConfig)
+	return NewSslWithConfig(net, add, tlsConfig, Config{})
+}
+
+// NewSslWithConfig connects a client to an NNTP server using tls with
+// the given settings.
+func NewSslWithConfig(net string, add string, tlsConfig *tls.Config, cfg Config) (*Client, error) {
+	return dialClient(func() (io.ReadWriteCloser, error) {
+		return tls.Dial(net, add, tlsConfig)
+	}, cfg)
+}
+
+// dialClient connects a client using dial, remembering it so the
+// client can reconnect later.
+func dialClient(dial func() (io.ReadWriteCloser, error), cfg Config) (*Client, error) {
+	conn, err := dial()
 	if err != nil {
 		return nil, err
 	}
-	return NewConn(conn)
+	c, err := connect(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.dial = dial
+	return c, nil
 }
 
 // NewConn wraps an existing connection, for example one opened with tls.Dial
 func NewConn(conn io.ReadWriteCloser) (*Client, error) {
-	return connect(textproto.NewConn(conn))
+	return NewConnWithConfig(conn, Config{})
+}
+
+// NewConnWithConfig wraps an existing connection with the given
+// settings.
+func NewConnWithConfig(conn io.ReadWriteCloser, cfg Config) (*Client, error) {
+	return connect(conn, cfg)
+}
+
+// ErrBadBanner is matched (with errors.Is) by the *BannerError
+// returned when a server's greeting isn't a valid response line.
+var ErrBadBanner = errors.New("malformed server banner")
+
+// A BannerError holds a greeting that couldn't be parsed, as sent by
+// something on the port that isn't speaking NNTP (or not yet).
+type BannerError struct {
+	Line string
+	Err  error
+}
+
+func (e *BannerError) Error() string {
+	return fmt.Sprintf("%v %q: %v", ErrBadBanner, e.Line, e.Err)
+}
+
+func (e *BannerError) Unwrap() error {
+	return e.Err
 }
 
-func connect(conn *textproto.Conn) (*Client, error) {
-	_, msg, err := conn.ReadCodeLine(200)
+func (e *BannerError) Is(target error) bool {
+	return target == ErrBadBanner
+}
+
+// readBannerLine reads the greeting and parses it as a code line
+// expecting 2xx, keeping the raw line for a *BannerError.
+func readBannerLine(conn *textproto.Conn) (int, string, error) {
+	line, err := conn.ReadLine()
+	if err != nil {
+		return 0, "", err
+	}
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(line + "\r\n")))
+	code, msg, err := r.ReadCodeLine(20)
+	if _, ok := err.(textproto.ProtocolError); ok {
+		return 0, "", &BannerError{line, err}
+	}
+	return code, msg, responseError(err)
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// readDeadline returns a way to set a read deadline on rwc, or nil if
+// it has none.  A Transport only has a combined deadline.
+func readDeadline(rwc io.ReadWriteCloser) func(time.Time) error {
+	switch d := rwc.(type) {
+	case readDeadliner:
+		return d.SetReadDeadline
+	case Transport:
+		return d.SetDeadline
+	}
+	return nil
+}
+
+// readBanner reads the greeting, giving up after timeout (if nonzero).
+//
+// Connections that can't take a read deadline are closed to unblock
+// the read.
+func readBanner(conn *textproto.Conn, rwc io.ReadWriteCloser, timeout time.Duration) (int, string, error) {
+	if timeout <= 0 {
+		return readBannerLine(conn)
+	}
+
+	if setDeadline := readDeadline(rwc); setDeadline != nil {
+		setDeadline(time.Now().Add(timeout))
+		code, msg, err := readBannerLine(conn)
+		setDeadline(time.Time{})
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = ErrBannerTimeout
+		}
+		return code, msg, err
+	}
+
+	type banner struct {
+		code int
+		msg  string
+		err  error
+	}
+	ch := make(chan banner, 1)
+	go func() {
+		code, msg, err := readBannerLine(conn)
+		ch <- banner{code, msg, err}
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case b := <-ch:
+		return b.code, b.msg, b.err
+	case <-t.C:
+		rwc.Close()
+		return 0, "", ErrBannerTimeout
+	}
+}
+
+func connect(rwc io.ReadWriteCloser, cfg Config) (*Client, error) {
+	conn := newTextprotoConn(rwc, cfg)
+	code, msg, err := readBanner(conn, rwc, cfg.ConnectTimeout)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
-		conn:   conn,
-		Banner: msg,
+		connection:     connection{conn: conn, rwc: rwc},
+		config:         cfg,
+		Banner:         msg,
+		PostingAllowed: code == 200,
 	}, nil
 }
 
+// Capabilities returns the server's capability list, fetching it on
+// first use.
 func (c *Client) Capabilities() ([]string, error) {
 	if !c.loadedCapabilities {
 		_, _, err := c.Command("CAPABILITIES", 101)
 		if err != nil {
 			return nil, err
 		}
-		lines, err := c.conn.ReadDotLines()
+		lines, err := c.readAllDotLines()
 		if err != nil {
 			return nil, err
 		}
 		c.capabilities = lines
+		c.loadedCapabilities = true
 	}
 
 	return c.capabilities, nil
 }
 
-// Close this client.
-func (c *Client) Close() error {
-	return c.conn.Close()
+// RefreshCapabilities discards the cached capability list and fetches
+// it again.
+func (c *Client) RefreshCapabilities() error {
+	_, err := c.CapabilitiesFresh()
+	return err
 }
 
-// Authenticate against an NNTP server using authinfo user/pass
-func (c *Client) Authenticate(user, pass string) (msg string, err error) {
-	err = c.conn.PrintfLine("authinfo user %s", user)
+// CapabilitiesFresh always asks the server for its capability list,
+// updating the cache used by Capabilities.  The list may change after
+// STARTTLS, authentication or MODE READER.
+func (c *Client) CapabilitiesFresh() ([]string, error) {
+	c.loadedCapabilities = false
+	return c.Capabilities()
+}
+
+// hasCapability reports whether the cached capability list advertises
+// the named capability (the first word of a capability line).
+func (c *Client) hasCapability(name string) bool {
+	for _, line := range c.capabilities {
+		if strings.EqualFold(strings.SplitN(line, " ", 2)[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilitiesParsed returns the capability list keyed by upper-cased
+// capability label, with the remaining words of each line as the
+// arguments.
+func (c *Client) CapabilitiesParsed() (map[string][]string, error) {
+	lines, err := c.Capabilities()
 	if err != nil {
-		return
+		return nil, err
+	}
+	rv := make(map[string][]string, len(lines))
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) > 0 {
+			rv[strings.ToUpper(f[0])] = f[1:]
+		}
+	}
+	return rv, nil
+}
+
+// ErrCompressionNotSupported is returned when asking for a compression
+// algorithm the server doesn't advertise.
+var ErrCompressionNotSupported = errors.New("compression not supported by server")
+
+// ErrMissingCapability is matched (with errors.Is) by the
+// *CapabilityError returned by Require.
+var ErrMissingCapability = errors.New("missing capability")
+
+// A CapabilityError lists the required capabilities a server lacks.
+type CapabilityError struct {
+	Missing []string
+}
+
+func (e *CapabilityError) Error() string {
+	return ErrMissingCapability.Error() + ": " + strings.Join(e.Missing, ", ")
+}
+
+func (e *CapabilityError) Unwrap() error {
+	return ErrMissingCapability
+}
+
+// Require checks that the server advertises each of the given
+// capabilities, returning a *CapabilityError naming any that are
+// missing.  A capability may include arguments, such as "COMPRESS
+// DEFLATE" or "LIST OVERVIEW.FMT", which must all be listed.  The
+// capability list is cached, so repeated calls don't query the server.
+func (c *Client) Require(caps ...string) error {
+	have, err := c.CapabilitiesParsed()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, want := range caps {
+		f := strings.Fields(want)
+		if len(f) == 0 {
+			continue
+		}
+		args, ok := have[strings.ToUpper(f[0])]
+		for _, w := range f[1:] {
+			found := false
+			for _, a := range args {
+				found = found || strings.EqualFold(a, w)
+			}
+			ok = ok && found
+		}
+		if !ok {
+			missing = append(missing, want)
+		}
 	}
-	_, _, err = c.conn.ReadCodeLine(381)
+	if len(missing) > 0 {
+		return &CapabilityError{missing}
+	}
+	return nil
+}
+
+// supportsCompression checks the COMPRESS capability (RFC 8054) for the
+// given algorithm, returning ErrCompressionNotSupported if it's absent.
+func (c *Client) supportsCompression(alg string) error {
+	caps, err := c.CapabilitiesParsed()
 	if err != nil {
-		return
+		return err
+	}
+	for _, a := range caps["COMPRESS"] {
+		if strings.EqualFold(a, alg) {
+			return nil
+		}
+	}
+	return ErrCompressionNotSupported
+}
+
+// afterAuth re-evaluates session state that may change once
+// authenticated.  A server without CAPABILITIES keeps the banner's
+// posting status.
+func (c *Client) afterAuth() {
+	if c.RefreshCapabilities() == nil {
+		c.PostingAllowed = c.hasCapability("POST")
+	}
+}
+
+// SetClock replaces the clock used for the dates the client generates,
+// such as the Date header of cancel messages.  nil restores time.Now.
+func (c *Client) SetClock(fn func() time.Time) {
+	c.now = fn
+}
+
+func (c *Client) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// ErrClientClosed is returned by commands on a client that has been
+// closed.
+var ErrClientClosed = errors.New("client closed")
+
+// closedConn stands in for the connection of a closed client.
+type closedConn struct{}
+
+func (closedConn) Read([]byte) (int, error)  { return 0, ErrClientClosed }
+func (closedConn) Write([]byte) (int, error) { return 0, ErrClientClosed }
+func (closedConn) Close() error              { return nil }
+
+// Close this client.  Closing an already closed client does nothing,
+// and any command on a closed client fails with ErrClientClosed.
+func (c *Client) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	err := c.conn.Close()
+	c.conn = textproto.NewConn(closedConn{})
+	return err
+}
+
+// Quit ends the session politely with QUIT, then closes the client.
+func (c *Client) Quit() error {
+	_, _, err := c.Command("QUIT", 205)
+	if cerr := c.Close(); err == nil {
+		err = cerr
 	}
+	return err
+}
 
-	err = c.conn.PrintfLine("authinfo pass %s", pass)
+// Authenticate against an NNTP server using authinfo user/pass
+//
+// Servers that accept the user name alone answer AUTHINFO USER with
+// 281, in which case no password is sent.
+func (c *Client) Authenticate(user, pass string) (msg string, err error) {
+	code, msg, err := c.command("authinfo user "+user, -1)
 	if err != nil {
 		return
 	}
-	_, msg, err = c.conn.ReadCodeLine(281)
+	switch code {
+	case 281:
+	case 381:
+		_, msg, err = c.command("authinfo pass "+pass, 281)
+		if err != nil {
+			return
+		}
+	default:
+		return "", &Error{Code: code, Msg: msg}
+	}
+	if c.config.AutoReauth {
+		c.user, c.pass = user, pass
+	}
+	c.afterAuth()
 	return
 }
 
+// AuthGeneric authenticates with AUTHINFO GENERIC, which hands the
+// exchange to a server-specific mechanism.
+//
+// Each 381 continuation is passed to respond, whose reply is sent back
+// to the server.  If respond fails, the exchange is cancelled with "*".
+// A refusal is returned as an *Error, such as ErrAuthRejected.
+func (c *Client) AuthGeneric(args string, respond func(challenge string) (string, error)) error {
+	err := c.conn.PrintfLine("AUTHINFO GENERIC %s", args)
+	for err == nil {
+		var code int
+		var msg string
+		code, msg, err = readCodeLine(c.conn, -1)
+		if err != nil {
+			return err
+		}
+		switch code {
+		case 281:
+			c.afterAuth()
+			return nil
+		case 381:
+			var reply string
+			if reply, err = respond(msg); err != nil {
+				if c.conn.PrintfLine("*") == nil {
+					readCodeLine(c.conn, -1)
+				}
+				return err
+			}
+			err = c.conn.PrintfLine("%s", reply)
+		default:
+			return &Error{Code: code, Msg: msg}
+		}
+	}
+	return err
+}
+
 func parsePosting(p string) nntp.PostingStatus {
 	switch p {
 	case "y":
@@ -124,382 +557,2244 @@ func parsePosting(p string) nntp.PostingStatus {
 }
 
 // List groups
+//
+// A wildmat that matches nothing yields an empty list, not an error.
 func (c *Client) List(sub string) (rv []nntp.Group, err error) {
 	_, _, err = c.Command("LIST "+sub, 215)
 	if err != nil {
 		return
 	}
 	var groupLines []string
-	groupLines, err = c.conn.ReadDotLines()
+	groupLines, err = c.readAllDotLines()
 	if err != nil {
 		return
 	}
 	rv = make([]nntp.Group, 0, len(groupLines))
 	for _, l := range groupLines {
-		parts := strings.Split(l, " ")
-		high, errh := strconv.ParseInt(parts[1], 10, 64)
-		low, errl := strconv.ParseInt(parts[2], 10, 64)
-		if errh == nil && errl == nil {
-			rv = append(rv, nntp.Group{
-				Name:    parts[0],
-				High:    high,
-				Low:     low,
-				Posting: parsePosting(parts[3]),
-			})
+		// name high low status
+		if g, ok := parseListLine(l, false); ok {
+			rv = append(rv, g)
 		}
 	}
 	return
 }
 
-// Group selects a group.
-func (c *Client) Group(name string) (rv nntp.Group, err error) {
-	var msg string
-	_, msg, err = c.Command("GROUP "+name, 211)
-	if err != nil {
-		return
+// parseListLine parses a LIST ACTIVE line, or with counts a LIST
+// COUNTS line, which has the article count before the status.
+func parseListLine(l string, counts bool) (nntp.Group, bool) {
+	parts := strings.Split(l, " ")
+	n := 4
+	if counts {
+		n = 5
 	}
-	// count first last name
-	parts := strings.Split(msg, " ")
-	if len(parts) != 4 {
-		err = errors.New("Don't know how to parse result: " + msg)
+	if len(parts) < n {
+		return nntp.Group{}, false
 	}
-	rv.Count, err = strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return
+	high, errh := strconv.ParseInt(parts[1], 10, 64)
+	low, errl := strconv.ParseInt(parts[2], 10, 64)
+	if errh != nil || errl != nil {
+		return nntp.Group{}, false
 	}
-	rv.Low, err = strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return
+	g := nntp.Group{
+		Name:    parts[0],
+		High:    high,
+		Low:     low,
+		Posting: parsePosting(parts[n-1]),
 	}
-	rv.High, err = strconv.ParseInt(parts[2], 10, 64)
-	if err != nil {
-		return
+	if counts {
+		var err error
+		if g.Count, err = strconv.ParseInt(parts[3], 10, 64); err != nil {
+			return nntp.Group{}, false
+		}
 	}
-	rv.Name = parts[3]
-
-	return
+	return g, true
 }
 
-// Article grabs an article
-func (c *Client) Article(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("ARTICLE %s", specifier)
+// ListCounts lists groups matching a wildmat with LIST COUNTS, an
+// extension that gives each group's exact article count along with
+// its LIST ACTIVE information, saving a GROUP per group.
+//
+// Servers without the extension refuse it with 503 (or 501), which is
+// returned as a *CapabilityError; use List and CountArticles instead.
+func (c *Client) ListCounts(wildmat string) ([]nntp.Group, error) {
+	cmd := "LIST COUNTS"
+	if wildmat != "" {
+		cmd += " " + wildmat
+	}
+	_, _, err := c.Command(cmd, 215)
+	var e *Error
+	if errors.As(err, &e) && (e.Code == 503 || e.Code == 501) {
+		return nil, &CapabilityError{[]string{"LIST COUNTS"}}
+	}
 	if err != nil {
-		return 0, "", nil, err
+		return nil, err
 	}
-	return c.articleish(220)
+	rv := []nntp.Group{}
+	err = c.readDotLines(func(line string) error {
+		if g, ok := parseListLine(line, true); ok {
+			rv = append(rv, g)
+		}
+		return nil
+	})
+	return rv, err
 }
 
-// Head gets the headers for an article
-func (c *Client) Head(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("HEAD %s", specifier)
-	if err != nil {
-		return 0, "", nil, err
+// DiffActive compares two List results by group name, for keeping a
+// group list up to date incrementally.  It returns the groups only in
+// new, those only in old, and those in both whose high or low
+// watermark changed (as they are in new).  Results follow the order of
+// the list they come from.
+func DiffActive(old, new []nntp.Group) (added, removed, changed []nntp.Group) {
+	before := make(map[string]nntp.Group, len(old))
+	for _, g := range old {
+		before[g.Name] = g
+	}
+	after := make(map[string]bool, len(new))
+	for _, g := range new {
+		after[g.Name] = true
+		o, ok := before[g.Name]
+		switch {
+		case !ok:
+			added = append(added, g)
+		case o.High != g.High || o.Low != g.Low:
+			changed = append(changed, g)
+		}
+	}
+	for _, g := range old {
+		if !after[g.Name] {
+			removed = append(removed, g)
+		}
 	}
-	return c.articleish(221)
+	return added, removed, changed
 }
 
-// Body gets the body of an article
-func (c *Client) Body(specifier string) (int64, string, io.Reader, error) {
-	err := c.conn.PrintfLine("BODY %s", specifier)
+// ListKeyValue sends LIST with the given subcommand (e.g.
+// "DISTRIBUTIONS" or "NEWSGROUPS misc.*") and splits each line of the
+// response at the first run of whitespace, preserving the order.
+//
+// This handles the many LIST variants shaped as a name followed by
+// free text, including vendor extensions.  Lines without whitespace get
+// an empty value.
+func (c *Client) ListKeyValue(sub string) ([][2]string, error) {
+	_, _, err := c.Command("LIST "+sub, 215)
 	if err != nil {
-		return 0, "", nil, err
+		return nil, err
 	}
-	return c.articleish(222)
+	rv := [][2]string{}
+	err = c.readDotLines(func(line string) error {
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			rv = append(rv, [2]string{line, ""})
+			return nil
+		}
+		rv = append(rv, [2]string{line[:i], strings.TrimLeft(line[i:], " \t")})
+		return nil
+	})
+	return rv, err
 }
 
-func (c *Client) overviewFmt() (res []OverHeader, err error) {
-	_, _, err = c.Command("LIST OVERVIEW.FMT", 215)
-	if err != nil {
-		return
+// ListNewsgroups lists the descriptions of groups matching a wildmat
+// (all groups if empty).  Only Name and Description are set.
+func (c *Client) ListNewsgroups(wildmat string) ([]nntp.Group, error) {
+	sub := "NEWSGROUPS"
+	if wildmat != "" {
+		sub += " " + wildmat
 	}
-	lines, err := c.conn.ReadDotLines()
+	kvs, err := c.ListKeyValue(sub)
 	if err != nil {
-		return
+		return nil, err
 	}
-	res = make([]OverHeader, 0)
-	for _, line := range lines {
-		switch line {
-		case "Subject:":
-			res = append(res, OverHeaderSubject)
-			break
-		case "From:":
-			res = append(res, OverHeaderFrm)
-			break
-		case "Date:":
-			res = append(res, OverHeaderDate)
-			break
-		case "Message-ID:":
-			res = append(res, OverHeaderMsgId)
-			break
-		case "References:":
-			res = append(res, OverHeaderReferences)
-			break
-		case ":bytes":
-		case "Bytes":
-			res = append(res, OverHeaderBytes)
-			break
-		case ":lines":
-		case "Lines":
-			res = append(res, OverHeaderLines)
-			break
-		case "Xref:full":
-			res = append(res, OverHeaderXRefFull)
-			break
+	rv := make([]nntp.Group, 0, len(kvs))
+	for _, kv := range kvs {
+		if kv[0] != "" {
+			rv = append(rv, nntp.Group{Name: kv[0], Description: strings.TrimSpace(kv[1])})
 		}
 	}
-	err = nil
-	return
+	return rv, nil
 }
 
-const (
-	SHORT_RFC1123  = "Mon, 02 Jan 06 15:04:05 MST"
-	SHORT_RFC1123Z = "Mon, 02 Jan 06 15:04:05 -0700" // RFC1123 with numeric zone
-)
-
-func parseDate(str string) (time.Time, error) {
-	t, err := time.Parse(time.RFC1123, str)
-	if err == nil {
-		return t, err
+// GroupHighWatermarks returns the high article number of each group
+// matching a wildmat (all groups if empty) from a single LIST ACTIVE,
+// which is much cheaper than selecting each group.
+func (c *Client) GroupHighWatermarks(wildmat string) (map[string]int64, error) {
+	sub := "ACTIVE"
+	if wildmat != "" {
+		sub += " " + wildmat
 	}
-
-	t, err = time.Parse(time.RFC1123Z, str)
-	if err == nil {
-		return t, err
+	groups, err := c.List(sub)
+	if err != nil {
+		return nil, err
 	}
-
-	t, err = time.Parse(SHORT_RFC1123, str)
-	if err == nil {
-		return t, err
+	rv := make(map[string]int64, len(groups))
+	for _, g := range groups {
+		rv[g.Name] = g.High
 	}
+	return rv, nil
+}
 
-	t, err = time.Parse(SHORT_RFC1123Z, str)
-	if err == nil {
-		return t, err
+// CanPost reports whether posting looks possible, so an article isn't
+// built only to be refused.
+//
+// Posting must be allowed by the banner (or after authenticating), by
+// the POST capability if the server lists capabilities, and by the
+// selected group's status in the active file, if a group is selected.
+// Posting to a moderated group counts as allowed, as the article is
+// passed on to the moderator.  A server without LIST ACTIVE is judged
+// by the session alone, but any other failure to list the group gives
+// false and the error.
+func (c *Client) CanPost() (bool, error) {
+	if !c.PostingAllowed {
+		return false, nil
 	}
-
-	str = strings.Replace(str, "+0000 (UTC)", "UTC", 1)
-	str = strings.Replace(str, "00 (UTC)", "00", 1)
-	t, err = time.Parse(time.RFC1123, str)
-	if err == nil {
-		return t, err
+	_, err := c.Capabilities()
+	switch {
+	case err == nil:
+		if !c.hasCapability("POST") {
+			return false, nil
+		}
+	case !IsUnsupported(err):
+		return false, err
 	}
 
-	t, err = time.Parse(time.RFC1123Z, str)
-	if err == nil {
-		return t, err
+	if c.group == "" {
+		return true, nil
 	}
-
-	t, err = time.Parse(SHORT_RFC1123, str)
-	if err == nil {
-		return t, err
+	groups, err := c.List("ACTIVE " + c.group)
+	var e *Error
+	if errors.As(err, &e) && (e.Code == 500 || e.Code == 501 || e.Code == 503) {
+		// No active information; go by the session alone.  Other
+		// refusals, such as 480 or 502 (access denied), count
+		// against posting.
+		return true, nil
 	}
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		if g.Name == c.group {
+			return g.Posting != nntp.PostingNotPermitted, nil
+		}
+	}
+	return true, nil
+}
 
-	t, err = time.Parse(SHORT_RFC1123Z, str)
-	return t, err
+// PostingLimits returns the largest article the server says it will
+// accept, so oversized posts can be refused before sending them.
+//
+// There's no standard way to advertise this.  Servers that do list a
+// MAXARTSIZE capability with the size in bytes, or a POST capability
+// argument of the form MAXARTSIZE=n.  ok is false when no limit is
+// advertised, including when CAPABILITIES isn't supported.
+func (c *Client) PostingLimits() (maxBytes int64, ok bool, err error) {
+	caps, err := c.CapabilitiesParsed()
+	if IsUnsupported(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if args := caps["MAXARTSIZE"]; len(args) > 0 {
+		if n, err := strconv.ParseInt(args[0], 10, 64); err == nil && n > 0 {
+			return n, true, nil
+		}
+	}
+	for _, a := range caps["POST"] {
+		if kv := strings.SplitN(a, "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "MAXARTSIZE") {
+			if n, err := strconv.ParseInt(kv[1], 10, 64); err == nil && n > 0 {
+				return n, true, nil
+			}
+		}
+	}
+	return 0, false, nil
 }
 
-type setter = func(*nntp.ArticleOverview, string) error
+// An ActiveTime records when a group was created, and by whom.
+type ActiveTime struct {
+	Name    string
+	Created time.Time
+	Creator string
+}
 
-var infoSetters = map[OverHeader]setter{
-	OverHeaderSubject: func(overview *nntp.ArticleOverview, s string) error {
-		overview.Subject = s
-		return nil
-	},
-	OverHeaderFrm: func(overview *nntp.ArticleOverview, s string) error {
-		overview.From = s
-		return nil
-	},
-	OverHeaderDate: func(overview *nntp.ArticleOverview, s string) error {
-		date, err := parseDate(s)
-		if err != nil {
-			return err
+// ListActiveTimes lists the creation times of groups matching a
+// wildmat (all groups if empty) from LIST ACTIVE.TIMES.  Malformed
+// lines are skipped.
+func (c *Client) ListActiveTimes(wildmat string) ([]ActiveTime, error) {
+	sub := "ACTIVE.TIMES"
+	if wildmat != "" {
+		sub += " " + wildmat
+	}
+	kvs, err := c.ListKeyValue(sub)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]ActiveTime, 0, len(kvs))
+	for _, kv := range kvs {
+		fields := strings.Fields(kv[1])
+		if len(fields) < 1 {
+			continue
 		}
-		overview.Date = date
-		return nil
-	},
-	OverHeaderMsgId: func(overview *nntp.ArticleOverview, s string) error {
-		overview.MessageId = s
-		return nil
-	},
-	OverHeaderReferences: func(overview *nntp.ArticleOverview, s string) error {
-		overview.References = s
-		return nil
-	},
-	OverHeaderLines: func(overview *nntp.ArticleOverview, s string) error {
-		lines, err := strconv.ParseUint(s, 10, 32)
+		secs, err := strconv.ParseInt(fields[0], 10, 64)
 		if err != nil {
-			return err
+			continue
 		}
-		overview.Lines = uint32(lines)
-		return nil
-	},
-	OverHeaderXRefFull: func(overview *nntp.ArticleOverview, s string) error {
-		overview.XRef = s
-		return nil
-	},
-	OverHeaderBytes: func(overview *nntp.ArticleOverview, s string) error {
-		bytes, err := strconv.ParseUint(s, 10, 32)
-		if err != nil {
-			return err
+		at := ActiveTime{Name: kv[0], Created: time.Unix(secs, 0).UTC()}
+		if len(fields) > 1 {
+			at.Creator = fields[1]
 		}
-		overview.Bytes = uint32(bytes)
-		return nil
-	},
+		rv = append(rv, at)
+	}
+	return rv, nil
 }
 
-func parseArticleOverview(line string, format []OverHeader) (*nntp.ArticleOverview, error) {
-	items := strings.Split(line, "\t")
-	res := &nntp.ArticleOverview{}
-	id, err := strconv.ParseUint(items[0], 10, 64)
+// GroupCreated returns when a single group was created and by whom,
+// without listing the whole of ACTIVE.TIMES.  If the server doesn't
+// list the group, the error is a *GroupError wrapping ErrNoSuchGroup.
+func (c *Client) GroupCreated(group string) (time.Time, string, error) {
+	times, err := c.ListActiveTimes(group)
 	if err != nil {
-		return nil, err
+		return time.Time{}, "", err
 	}
-	res.Id = id
-	for i := 1; i < len(items) && i-1 < len(format); i++ {
-		setter, ok := infoSetters[format[i-1]]
-		if ok {
-			err := setter(res, items[i])
-			if err != nil {
-				return nil, err
-			}
+	for _, at := range times {
+		if at.Name == group {
+			return at.Created, at.Creator, nil
 		}
 	}
-	return res, nil
+	return time.Time{}, "", &GroupError{group, ErrNoSuchGroup}
 }
 
-func (c *Client) Over(start int64, end int64) ([]*nntp.ArticleOverview, error) {
+// GroupInfo is a group's active file entry joined with its
+// description (in Group.Description).
+type GroupInfo struct {
+	nntp.Group
+	// Active is false for groups that only appear in LIST NEWSGROUPS,
+	// in which case the watermarks and posting status are unknown.
+	Active bool
+}
 
-	if len(c.overViewFormat) == 0 {
-		fmt, err := c.overviewFmt()
-		if err != nil {
-			return nil, err
-		}
-		c.overViewFormat = fmt
+// GroupsWithDescriptions lists the groups matching a wildmat along with
+// their descriptions, using both LIST ACTIVE and LIST NEWSGROUPS.
+//
+// Groups are returned in active file order, with any groups that are
+// only described (but not active) at the end.  Active groups with no
+// description have an empty Description.
+func (c *Client) GroupsWithDescriptions(wildmat string) ([]GroupInfo, error) {
+	sub := "ACTIVE"
+	if wildmat != "" {
+		sub += " " + wildmat
 	}
-	cmd := fmt.Sprintf("OVER %v-%v", start, end)
-	_, _, err := c.Command(cmd, 224)
+	active, err := c.List(sub)
 	if err != nil {
 		return nil, err
 	}
+	described, err := c.ListNewsgroups(wildmat)
+	if err != nil {
+		return nil, err
+	}
+
+	descs := make(map[string]string, len(described))
+	for _, g := range described {
+		descs[g.Name] = g.Description
+	}
+	rv := make([]GroupInfo, 0, len(active))
+	for _, g := range active {
+		g.Description = descs[g.Name]
+		delete(descs, g.Name)
+		rv = append(rv, GroupInfo{Group: g, Active: true})
+	}
+	for _, g := range described {
+		if _, ok := descs[g.Name]; ok {
+			rv = append(rv, GroupInfo{Group: g})
+		}
+	}
+	return rv, nil
+}
+
+// Group selects a group.
+//
+// The returned Count is the server's estimate from the GROUP
+// response, which may differ from the number of articles actually
+// available (and from counts derived from the active file).
+func (c *Client) Group(name string) (rv nntp.Group, err error) {
+	var msg string
+	_, msg, err = c.Command("GROUP "+name, 211)
+	if err != nil {
+		if errors.Is(err, ErrNoSuchGroup) {
+			err = &GroupError{name, err}
+		}
+		return
+	}
+	// count first last name, possibly followed by commentary.
+	parts := strings.Fields(msg)
+	if len(parts) < 4 {
+		err = errors.New("Don't know how to parse result: " + msg)
+		return
+	}
+	rv.Count, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	rv.Low, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+	rv.High, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+	rv.Name = parts[3]
+	c.group = name
+
+	if c.overCache != nil {
+		c.overCache.observe(name, rv.High)
+	}
+
+	// An empty group reports high < low; the count must be zero then.
+	// Otherwise the first article becomes current.
+	c.article = 0
+	if rv.High < rv.Low {
+		rv.Count = 0
+	} else if rv.Count > 0 {
+		c.article = rv.Low
+	}
+
+	return
+}
+
+// GroupStat selects a group and returns its low and high watermarks
+// along with the server's estimated article count.
+//
+// For an empty group, high is lower than low and estimate is 0.
+func (c *Client) GroupStat(name string) (low, high, estimate int64, err error) {
+	g, err := c.Group(name)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return g.Low, g.High, g.Count, nil
+}
 
-	var v []*nntp.ArticleOverview
+// readDotLines reads a dot-terminated multi-line response, calling fn
+// for each unstuffed line without buffering the whole response.  If fn
+// fails, the rest of the response is still consumed so the connection
+// stays in sync, and fn's error returned.
+func (c *Client) readDotLines(fn func(line string) error) error {
+	var ferr error
+	var buf []byte
 	for {
 		var line string
-		line, err = c.conn.ReadLine()
+		var err error
+		if c.config.MaxLineBytes > 0 {
+			var raw []byte
+			raw, err = c.readRawLine(&buf)
+			line = string(bytes.TrimRight(raw, "\r\n"))
+		} else {
+			line, err = c.conn.ReadLine()
+		}
+		if err == ErrLineTooLong {
+			if ferr == nil {
+				ferr = err
+			}
+			continue
+		}
 		if err != nil {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			break
+			return err
 		}
 
-		// Dot by itself marks end; otherwise cut one dot.
+		// Dot by itself marks end; otherwise cut one dot.  Stuffing
+		// adds exactly one, so a stuffed ".." stays "." (RFC 3977
+		// section 3.1.1, and as textproto's DotReader does).
 		if len(line) > 0 && line[0] == '.' {
 			if len(line) == 1 {
-				break
+				return ferr
 			}
 			line = line[1:]
 		}
-		art, err := parseArticleOverview(line, c.overViewFormat)
-		if err != nil {
-			return nil, err
+		if ferr == nil {
+			ferr = fn(line)
 		}
-
-		v = append(v, art)
 	}
-	return v, nil
 }
 
-func (c *Client) XOver(start int64, end int64) ([]*nntp.ArticleOverview, error) {
+// readAllDotLines collects the lines of a dot-terminated response,
+// within the MaxLineBytes limit.
+func (c *Client) readAllDotLines() ([]string, error) {
+	var rv []string
+	err := c.readDotLines(func(line string) error {
+		rv = append(rv, line)
+		return nil
+	})
+	return rv, err
+}
 
-	if len(c.overViewFormat) == 0 {
-		fmt, err := c.overviewFmt()
-		if err != nil {
-			return nil, err
+// ErrLineTooLong is returned when a response line is longer than the
+// configured MaxLineBytes.
+var ErrLineTooLong = errors.New("response line too long")
+
+// readRawLine reads a line including its line ending.  The result may
+// refer into the read buffer or *buf, so is only valid until the next
+// read.  A line longer than MaxLineBytes is consumed without being
+// kept, and ErrLineTooLong returned.
+func (c *Client) readRawLine(buf *[]byte) ([]byte, error) {
+	max := c.config.MaxLineBytes
+	line, err := c.conn.R.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		if err == nil && max > 0 && len(bytes.TrimRight(line, "\r\n")) > max {
+			return nil, ErrLineTooLong
+		}
+		return line, err
+	}
+
+	// Long line; collect it in buf, unless it's over the limit.
+	*buf = append((*buf)[:0], line...)
+	n := len(line)
+	for err == bufio.ErrBufferFull {
+		line, err = c.conn.R.ReadSlice('\n')
+		n += len(line)
+		if max <= 0 || n <= max+2 {
+			*buf = append(*buf, line...)
 		}
-		c.overViewFormat = fmt
 	}
-	cmd := fmt.Sprintf("XOVER %v-%v", start, end)
-	_, _, err := c.Command(cmd, 224)
 	if err != nil {
 		return nil, err
 	}
+	if max > 0 && (n > max+2 || len(bytes.TrimRight(*buf, "\r\n")) > max) {
+		return nil, ErrLineTooLong
+	}
+	return *buf, nil
+}
 
-	var v []*nntp.ArticleOverview
+// readDotLinesRaw is like readDotLines, but passes each line to fn as
+// sent, including its line ending and any trailing whitespace.  Only
+// dot-stuffing is undone.  The slice is only valid during the call.
+func (c *Client) readDotLinesRaw(fn func(line []byte) error) error {
+	var ferr error
+	var buf []byte
 	for {
-		var line string
-		line, err = c.conn.ReadLine()
+		line, err := c.readRawLine(&buf)
+		if err == ErrLineTooLong {
+			if ferr == nil {
+				ferr = err
+			}
+			continue
+		}
 		if err != nil {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			break
+			return err
 		}
 
-		// Dot by itself marks end; otherwise cut one dot.
 		if len(line) > 0 && line[0] == '.' {
-			if len(line) == 1 {
-				break
+			if string(line) == ".\r\n" || string(line) == ".\n" {
+				return ferr
 			}
 			line = line[1:]
 		}
-		art, err := parseArticleOverview(line, c.overViewFormat)
+		if ferr == nil {
+			ferr = fn(line)
+		}
+	}
+}
+
+// listGroup issues LISTGROUP for a group (and optional range) and
+// streams the article numbers to fn.
+func (c *Client) listGroup(name, rng string, fn func(int64) error) (rv nntp.Group, err error) {
+	cmd := "LISTGROUP " + name
+	if rng != "" {
+		cmd += " " + rng
+	}
+	var msg string
+	_, msg, err = c.Command(cmd, 211)
+	if err != nil {
+		return
+	}
+	parts := strings.Split(msg, " ")
+	if len(parts) >= 4 {
+		rv.Count, _ = strconv.ParseInt(parts[0], 10, 64)
+		rv.Low, _ = strconv.ParseInt(parts[1], 10, 64)
+		rv.High, _ = strconv.ParseInt(parts[2], 10, 64)
+		rv.Name = parts[3]
+		if c.overCache != nil {
+			c.overCache.observe(name, rv.High)
+		}
+	}
+	// LISTGROUP selects the group, as GROUP does.
+	c.group = name
+	c.article = 0
+	if rv.Count > 0 && rv.High >= rv.Low {
+		c.article = rv.Low
+	}
+	err = c.readDotLines(func(line string) error {
+		n, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		return fn(n)
+	})
+	return
+}
+
+// ListGroupRange selects a group and lists the numbers of its articles
+// within r, for paging through a large group.
+func (c *Client) ListGroupRange(name string, r Range) ([]int64, error) {
+	var rv []int64
+	err := c.ListGroupRangeFunc(name, r, func(n int64) error {
+		rv = append(rv, n)
+		return nil
+	})
+	return rv, err
+}
+
+// ListGroupRangeFunc is like ListGroupRange, but calls fn with each
+// article number as it arrives rather than collecting them.
+//
+// Only the numbers of articles that exist are listed, so a range
+// reaching past either end of the group yields just those within it.
+func (c *Client) ListGroupRangeFunc(name string, r Range, fn func(int64) error) error {
+	_, err := c.listGroup(name, r.String(), func(n int64) error {
+		if n < r.Low || (!r.Open() && n > r.High) {
+			return nil
 		}
+		return fn(n)
+	})
+	return err
+}
 
-		v = append(v, art)
+// CountArticles returns the server's estimated article count for a
+// group.
+//
+// This is a single GROUP round trip, but the estimate may be higher
+// than the number of articles actually available.
+func (c *Client) CountArticles(group string) (int64, error) {
+	g, err := c.Group(group)
+	if err != nil {
+		return 0, err
 	}
-	return v, nil
+	return g.Count, nil
+}
+
+// CountArticlesExact counts the articles in a group by listing them
+// with LISTGROUP.
+//
+// This transfers one line per article, so it's much more expensive
+// than CountArticles on large groups, though the numbers are counted
+// as they arrive rather than held in memory.
+func (c *Client) CountArticlesExact(group string) (int64, error) {
+	var n int64
+	_, err := c.listGroup(group, "", func(int64) error {
+		n++
+		return nil
+	})
+	return n, err
 }
-func (c *Client) articleish(expected int) (int64, string, io.Reader, error) {
-	_, msg, err := c.conn.ReadCodeLine(expected)
+
+// Article grabs an article
+func (c *Client) Article(specifier string) (int64, string, io.Reader, error) {
+	return c.articleish("ARTICLE "+specifier, 220)
+}
+
+// ArticleSplit fetches an article, parsing its headers and returning
+// the body as a stream.  As with Article, the body must be read to the
+// end before issuing another command.
+func (c *Client) ArticleSplit(specifier string) (textproto.MIMEHeader, io.Reader, error) {
+	_, _, r, err := c.Article(specifier)
 	if err != nil {
-		return 0, "", nil, err
+		return nil, nil, err
 	}
-	parts := strings.SplitN(msg, " ", 2)
-	n, err := strconv.ParseInt(parts[0], 10, 64)
+	br := bufio.NewReader(r)
+	h, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		io.Copy(io.Discard, br)
+		return nil, nil, err
+	}
+	return h, br, nil
+}
+
+// A FetchedArticle is an article read in full by Articles.
+type FetchedArticle struct {
+	Number    int64
+	MessageID string
+	Header    textproto.MIMEHeader
+	Body      []byte
+}
+
+// fetchArticle reads a whole article before returning, leaving the
+// connection ready for the next command.  If the headers can't be
+// parsed the article is still returned, with the raw text as its Body,
+// alongside the error.
+func (c *Client) fetchArticle(specifier string) (*FetchedArticle, error) {
+	n, id, r, err := c.Article(specifier)
 	if err != nil {
-		return 0, "", nil, err
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
-	return n, parts[1], c.conn.DotReader(), nil
+	br := bufio.NewReader(bytes.NewReader(data))
+	h, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return &FetchedArticle{Number: n, MessageID: id, Body: data}, err
+	}
+	body, _ := io.ReadAll(br)
+	return &FetchedArticle{Number: n, MessageID: id, Header: h, Body: body}, nil
 }
 
-// Post a new article
+// Articles fetches each of the specified articles in turn, returning
+// the articles and errors in slices parallel to specifiers.
 //
-// The reader should contain the entire article, headers and body in
-// RFC822ish format.
-func (c *Client) Post(r io.Reader) error {
-	err := c.conn.PrintfLine("POST")
+// A server response such as 430 (no such article), or headers that
+// can't be parsed, is recorded against its article and fetching
+// carries on.  A connection error (see IsConnectionError) stops the
+// batch and is recorded against every article not yet fetched.
+func (c *Client) Articles(specifiers []string) ([]*FetchedArticle, []error) {
+	rv := make([]*FetchedArticle, len(specifiers))
+	errs := make([]error, len(specifiers))
+	for i, spec := range specifiers {
+		rv[i], errs[i] = c.fetchArticle(spec)
+		if IsConnectionError(errs[i]) {
+			for j := i + 1; j < len(specifiers); j++ {
+				errs[j] = errs[i]
+			}
+			break
+		}
+	}
+	return rv, errs
+}
+
+// Head gets the headers for an article
+func (c *Client) Head(specifier string) (int64, string, io.Reader, error) {
+	return c.articleish("HEAD "+specifier, 221)
+}
+
+// ArticlePath returns the hops in an article's Path header, latest
+// first.  Empty segments (such as the "!!" RFC 5537 diagnostic marker)
+// and the conventional trailing "not-for-mail" are left out.
+func (c *Client) ArticlePath(specifier string) ([]string, error) {
+	h, err := c.HeaderFields(specifier, "Path")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	segs := strings.Split(strings.TrimSpace(h["Path"]), "!")
+	if len(segs) > 0 && segs[len(segs)-1] == "not-for-mail" {
+		segs = segs[:len(segs)-1]
 	}
-	_, _, err = c.conn.ReadCodeLine(340)
+	rv := []string{}
+	for _, s := range segs {
+		if s = strings.TrimSpace(s); s != "" {
+			rv = append(rv, s)
+		}
+	}
+	return rv, nil
+}
+
+// HeaderFields fetches an article's headers with a single HEAD and
+// returns the requested fields, keyed by their canonical names (as in
+// textproto.CanonicalMIMEHeaderKey).  Absent fields map to "".
+func (c *Client) HeaderFields(specifier string, fields ...string) (map[string]string, error) {
+	_, _, r, err := c.Head(specifier)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	w := c.conn.DotWriter()
-	_, err = io.Copy(w, r)
+	h, err := readHeader(r)
 	if err != nil {
-		// This seems really bad
-		return err
+		return nil, err
 	}
-	w.Close()
-	_, _, err = c.conn.ReadCodeLine(240)
-	return err
+	rv := make(map[string]string, len(fields))
+	for _, f := range fields {
+		f = textproto.CanonicalMIMEHeaderKey(f)
+		rv[f] = h.Get(f)
+	}
+	return rv, nil
 }
 
-// Command sends a low-level command and get a response.
+// ArticleNewsgroups returns the groups an article was posted to, from
+// its Newsgroups header.  The result is empty if there's no such
+// header.
+func (c *Client) ArticleNewsgroups(specifier string) ([]string, error) {
+	h, err := c.HeaderFields(specifier, "Newsgroups")
+	if err != nil {
+		return nil, err
+	}
+	rv := []string{}
+	for _, g := range strings.Split(h["Newsgroups"], ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			rv = append(rv, g)
+		}
+	}
+	return rv, nil
+}
+
+// Body gets the body of an article
+func (c *Client) Body(specifier string) (int64, string, io.Reader, error) {
+	return c.articleish("BODY "+specifier, 222)
+}
+
+// Stat checks whether an article exists without fetching it, returning
+// its number and message-id.
 //
-// This will return an error if the code doesn't match the expectCode
-// prefix.  For example, if you specify "200", the response code MUST
-// be 200 or you'll get an error.  If you specify "2", any code from
-// 200 (inclusive) to 300 (exclusive) will be success.  An expectCode
-// of -1 disables this behavior.
-func (c *Client) Command(cmd string, expectCode int) (int, string, error) {
-	err := c.conn.PrintfLine(cmd)
+// An empty specifier checks the current article.  Selecting an
+// article by number makes it current.
+func (c *Client) Stat(specifier string) (int64, string, error) {
+	cmd := "STAT"
+	if specifier != "" {
+		cmd += " " + specifier
+	} else if c.article == 0 {
+		return 0, "", ErrNoCurrentArticle
+	}
+	n, id, err := c.move(cmd)
+	// Selecting by message-id leaves the current article alone.
+	if err == nil && !strings.HasPrefix(specifier, "<") {
+		c.article = n
+	}
+	return n, id, err
+}
+
+// Next moves to the next article in the group, returning its number
+// and message-id.
+func (c *Client) Next() (int64, string, error) {
+	return c.step("NEXT")
+}
+
+// Last moves to the previous article in the group, returning its
+// number and message-id.
+func (c *Client) Last() (int64, string, error) {
+	return c.step("LAST")
+}
+
+func (c *Client) step(cmd string) (int64, string, error) {
+	if c.article == 0 {
+		return 0, "", ErrNoCurrentArticle
+	}
+	n, id, err := c.move(cmd)
+	if err == nil {
+		c.article = n
+	}
+	return n, id, err
+}
+
+// move sends a command answered with 223 and the article's number and
+// message-id.
+func (c *Client) move(cmd string) (int64, string, error) {
+	_, msg, err := c.Command(cmd, 223)
 	if err != nil {
+		if errors.Is(err, ErrNoCurrentArticle) {
+			c.article = 0
+		}
 		return 0, "", err
 	}
-	return c.conn.ReadCodeLine(expectCode)
+	return parseStatResponse(msg)
+}
+
+// parseStatResponse parses the number and message-id from a 223
+// response.
+func parseStatResponse(msg string) (int64, string, error) {
+	parts := strings.SplitN(msg, " ", 3)
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) < 2 {
+		return 0, "", errors.New("Don't know how to parse result: " + msg)
+	}
+	return n, parts[1], nil
+}
+
+// pipelineWindow is how many commands StatMany sends before reading
+// their responses.
+const pipelineWindow = 64
+
+// StatMany checks several articles with pipelined STAT commands,
+// returning each one's number, or its error.
+//
+// As with Articles, an error from the server only affects its own
+// article, while a connection error is returned for it and all the
+// articles after it.
+func (c *Client) StatMany(specifiers []string) ([]int64, []error) {
+	rv := make([]int64, len(specifiers))
+	errs := make([]error, len(specifiers))
+	for start := 0; start < len(specifiers); start += pipelineWindow {
+		end := start + pipelineWindow
+		if end > len(specifiers) {
+			end = len(specifiers)
+		}
+		for _, spec := range specifiers[start:end] {
+			if err := c.queueCommand("STAT %s", spec); err != nil {
+				return rv, failFrom(errs, start, err)
+			}
+		}
+		for i := start; i < end; i++ {
+			_, msg, err := readCodeLine(c.conn, 223)
+			var e *Error
+			if err != nil && !errors.As(err, &e) {
+				return rv, failFrom(errs, i, err)
+			}
+			if err == nil {
+				rv[i], _, err = parseStatResponse(msg)
+			}
+			if err == nil && !strings.HasPrefix(specifiers[i], "<") {
+				c.article = rv[i]
+			}
+			errs[i] = err
+		}
+	}
+	return rv, errs
+}
+
+// failFrom sets err for errs[i] onwards.
+func failFrom(errs []error, i int, err error) []error {
+	for ; i < len(errs); i++ {
+		errs[i] = err
+	}
+	return errs
+}
+
+// isNoArticle reports whether err says the requested article doesn't
+// exist (430, 423 or 420).
+func isNoArticle(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == 430 || e.Code == 423 || e.Code == 420
+	}
+	return false
+}
+
+// Probe reports whether an article exists and, if so, its size in
+// bytes and lines.
+//
+// Existence is checked with STAT and the size taken from the article's
+// overview.  If overview data isn't available, the Bytes and Lines
+// headers from HEAD are used instead (either may be zero if the server
+// doesn't provide them).  A missing article is not an error.
+func (c *Client) Probe(specifier string) (exists bool, bytes uint32, lines uint32, err error) {
+	_, _, err = c.Stat(specifier)
+	if isNoArticle(err) {
+		return false, 0, 0, nil
+	}
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	format, err := c.overviewFormat()
+	if err == nil {
+		var res []*nntp.ArticleOverview
+		res, err = c.overview("OVER", specifier, format)
+		if err == nil && len(res) == 1 {
+			return true, res[0].Bytes, res[0].Lines, nil
+		}
+	}
+	if err == nil || !IsConnectionError(err) {
+		_, _, r, err := c.Head(specifier)
+		if err != nil {
+			return true, 0, 0, err
+		}
+		h, err := readHeader(r)
+		if err != nil {
+			return true, 0, 0, err
+		}
+		b, _ := strconv.ParseUint(strings.TrimSpace(h.Get("Bytes")), 10, 32)
+		l, _ := strconv.ParseUint(strings.TrimSpace(h.Get("Lines")), 10, 32)
+		return true, uint32(b), uint32(l), nil
+	}
+	return true, 0, 0, err
+}
+
+// ErrBodyTooLarge is returned by BodyBounded when an article body
+// exceeds the allowed size.
+var ErrBodyTooLarge = errors.New("article body too large")
+
+// BodyBounded copies the body of an article to w, up to maxBytes.
+//
+// If the server sends more than that, the rest of the body is
+// discarded (keeping the connection usable) and ErrBodyTooLarge is
+// returned along with the number of bytes written.
+func (c *Client) BodyBounded(specifier string, maxBytes int64, w io.Writer) (int64, error) {
+	_, _, r, err := c.Body(specifier)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(w, r, maxBytes)
+	if err == io.EOF {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+	extra, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return n, err
+	}
+	if extra > 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, nil
+}
+
+// ErrNoOverviewFormat is returned by the overview methods when the
+// server doesn't provide a usable LIST OVERVIEW.FMT.  Callers may want
+// to fall back to HDR or HEAD.
+var ErrNoOverviewFormat = errors.New("no usable overview format")
+
+// overviewField is one entry of the server's overview format.
+type overviewField struct {
+	header OverHeader
+	// The advertised name, without any "full" suffix.
+	name string
+	// Full fields include the header name in the overview data.
+	full bool
+}
+
+func parseOverviewField(line string) overviewField {
+	f := overviewField{name: line}
+	if i := strings.Index(line, ":"); i > 0 && strings.EqualFold(line[i+1:], "full") {
+		f.name = line[:i+1]
+		f.full = true
+	}
+	switch strings.ToLower(f.name) {
+	case "subject:":
+		f.header = OverHeaderSubject
+	case "from:":
+		f.header = OverHeaderFrm
+	case "date:":
+		f.header = OverHeaderDate
+	case "message-id:":
+		f.header = OverHeaderMsgId
+	case "references:":
+		f.header = OverHeaderReferences
+	case ":bytes", "bytes:", "bytes":
+		f.header = OverHeaderBytes
+	case ":lines", "lines:", "lines":
+		f.header = OverHeaderLines
+	case "xref:":
+		f.header = OverHeaderXRefFull
+	}
+	return f
+}
+
+// value returns the field's value from an overview item, removing the
+// "Name: " prefix of full fields.
+func (f overviewField) value(item string) string {
+	if f.full && len(item) >= len(f.name) &&
+		strings.EqualFold(item[:len(f.name)], f.name) {
+		return strings.TrimLeft(item[len(f.name):], " ")
+	}
+	return item
+}
+
+// OverviewFormatRaw returns the lines of LIST OVERVIEW.FMT exactly as
+// the server sent them, including metadata items such as ":bytes" and
+// "full" suffixes.  It's meant for debugging field mapping: the format
+// is fetched afresh on each call, and the parsed format used by the
+// overview methods is left alone.
+func (c *Client) OverviewFormatRaw() ([]string, error) {
+	if _, _, err := c.Command("LIST OVERVIEW.FMT", 215); err != nil {
+		return nil, err
+	}
+	return c.readAllDotLines()
+}
+
+func (c *Client) overviewFmt() (res []overviewField, err error) {
+	lines, err := c.OverviewFormatRaw()
+	if err != nil {
+		if _, ok := err.(*Error); ok {
+			err = ErrNoOverviewFormat
+		}
+		return
+	}
+	// Unrecognized fields are kept so the positions of the rest line up.
+	known := 0
+	res = make([]overviewField, 0, len(lines))
+	for _, line := range lines {
+		f := parseOverviewField(line)
+		if f.header != 0 {
+			known++
+		}
+		res = append(res, f)
+	}
+	if known == 0 {
+		return nil, ErrNoOverviewFormat
+	}
+	return res, nil
+}
+
+const (
+	SHORT_RFC1123  = "Mon, 02 Jan 06 15:04:05 MST"
+	SHORT_RFC1123Z = "Mon, 02 Jan 06 15:04:05 -0700" // RFC1123 with numeric zone
+)
+
+func parseDate(str string) (time.Time, error) {
+	t, err := time.Parse(time.RFC1123, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(time.RFC1123Z, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(SHORT_RFC1123, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(SHORT_RFC1123Z, str)
+	if err == nil {
+		return t, err
+	}
+
+	str = strings.Replace(str, "+0000 (UTC)", "UTC", 1)
+	str = strings.Replace(str, "00 (UTC)", "00", 1)
+	t, err = time.Parse(time.RFC1123, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(time.RFC1123Z, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(SHORT_RFC1123, str)
+	if err == nil {
+		return t, err
+	}
+
+	t, err = time.Parse(SHORT_RFC1123Z, str)
+	return t, err
+}
+
+type setter = func(*nntp.ArticleOverview, string) error
+
+var infoSetters = map[OverHeader]setter{
+	OverHeaderSubject: func(overview *nntp.ArticleOverview, s string) error {
+		overview.Subject = s
+		return nil
+	},
+	OverHeaderFrm: func(overview *nntp.ArticleOverview, s string) error {
+		overview.From = s
+		return nil
+	},
+	OverHeaderDate: func(overview *nntp.ArticleOverview, s string) error {
+		date, err := parseDate(s)
+		if err != nil {
+			return err
+		}
+		overview.Date = date
+		return nil
+	},
+	OverHeaderMsgId: func(overview *nntp.ArticleOverview, s string) error {
+		overview.MessageId = s
+		return nil
+	},
+	OverHeaderReferences: func(overview *nntp.ArticleOverview, s string) error {
+		overview.References = s
+		return nil
+	},
+	OverHeaderLines: func(overview *nntp.ArticleOverview, s string) error {
+		lines, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		overview.Lines = uint32(lines)
+		return nil
+	},
+	OverHeaderXRefFull: func(overview *nntp.ArticleOverview, s string) error {
+		overview.XRef = s
+		return nil
+	},
+	OverHeaderBytes: func(overview *nntp.ArticleOverview, s string) error {
+		bytes, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		overview.Bytes = uint32(bytes)
+		return nil
+	},
+}
+
+// ErrArticleNumberRange is returned for an overview line whose article
+// number is beyond the int64 range.
+var ErrArticleNumberRange = errors.New("article number out of range")
+
+// parseArticleOverview parses an overview line with the given format.
+//
+// Servers may leave off empty trailing fields, so a short line just
+// leaves the missing fields zero.  Items beyond the end of the format
+// have no name to go by and are dropped.  Full fields the format lists
+// but that have no place in ArticleOverview are kept in Extra.
+func parseArticleOverview(line string, format []overviewField) (*nntp.ArticleOverview, error) {
+	items := strings.Split(line, "\t")
+	res := &nntp.ArticleOverview{}
+	id, err := strconv.ParseUint(items[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if id > math.MaxInt64 {
+		// Wouldn't fit the int64 numbers of Range and the rest.
+		return nil, ErrArticleNumberRange
+	}
+	res.Id = id
+	for i := 1; i < len(items) && i-1 < len(format); i++ {
+		f := format[i-1]
+		setter, ok := infoSetters[f.header]
+		if ok {
+			err := setter(res, f.value(items[i]))
+			if err != nil {
+				return nil, err
+			}
+		} else if f.full && items[i] != "" {
+			if res.Extra == nil {
+				res.Extra = make(map[string]string)
+			}
+			res.Extra[strings.TrimSuffix(f.name, ":")] = f.value(items[i])
+		}
+	}
+	return res, nil
+}
+
+// parseOverview parses an overview line, applying the client's
+// settings.
+func (c *Client) parseOverview(line string, format []overviewField) (*nntp.ArticleOverview, error) {
+	art, err := parseArticleOverview(line, format)
+	if err == nil && c.config.SplitXRefHost {
+		splitXRefHost(art)
+	}
+	return art, err
+}
+
+// splitXRefHost moves the leading server name of an Xref into
+// XRefHost.
+func splitXRefHost(art *nntp.ArticleOverview) {
+	f := strings.Fields(art.XRefClean())
+	if len(f) == 0 || strings.Contains(f[0], ":") {
+		// No host, just refs.
+		return
+	}
+	art.XRefHost = f[0]
+	art.XRef = strings.Join(f[1:], " ")
+}
+
+// overviewFormat returns the server's overview format, fetching it on
+// first use.
+func (c *Client) overviewFormat() ([]overviewField, error) {
+	if len(c.overViewFormat) == 0 {
+		fmt, err := c.overviewFmt()
+		if err != nil {
+			return nil, err
+		}
+		c.overViewFormat = fmt
+	}
+	return c.overViewFormat, nil
+}
+
+// overview issues an OVER style command for a range (or message-id)
+// and parses the response with the given format.
+//
+// If the server has lost track of the selected group (for example after
+// a reconnect), the last group selected with Group is re-selected and
+// the command retried.  With no group ever selected, the error matches
+// ErrNoGroupSelected.
+func (c *Client) overview(verb, spec string, format []overviewField) ([]*nntp.ArticleOverview, error) {
+	return c.overviewInto(nil, verb, spec, format)
+}
+
+// overviewInto is overview, appending to dst.
+func (c *Client) overviewInto(dst []*nntp.ArticleOverview, verb, spec string, format []overviewField) ([]*nntp.ArticleOverview, error) {
+	return c.overviewFunc(dst, verb, spec, func(line string) (*nntp.ArticleOverview, error) {
+		return c.parseOverview(line, format)
+	})
+}
+
+// overviewFunc sends an overview command and appends each line, as
+// parsed by parse, to dst.  Lines parsed as nil are skipped.  An empty
+// range (423, or 420 with no current article) isn't an error.
+func (c *Client) overviewFunc(dst []*nntp.ArticleOverview, verb, spec string, parse func(string) (*nntp.ArticleOverview, error)) ([]*nntp.ArticleOverview, error) {
+	_, _, err := c.Command(verb+" "+spec, 224)
+	if errors.Is(err, ErrNoGroupSelected) && c.group != "" {
+		if _, err = c.Group(c.group); err != nil {
+			return nil, err
+		}
+		_, _, err = c.Command(verb+" "+spec, 224)
+	}
+	var e *Error
+	if errors.As(err, &e) && (e.Code == 423 || e.Code == 420) {
+		// No articles in the range (or no current article).
+		return dst, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := dst
+	err = c.readDotLines(func(line string) error {
+		art, err := parse(line)
+		if err != nil {
+			return err
+		}
+		if art != nil {
+			v = append(v, art)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OverNumbers fetches the overviews of the given articles, requesting
+// each run of consecutive numbers as a single range.
+//
+// Results are in the order the numbers were given, with duplicates
+// returned once and articles the server doesn't have left out.
+func (c *Client) OverNumbers(numbers []int64) ([]*nntp.ArticleOverview, error) {
+	sorted := append([]int64(nil), numbers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	byNumber := make(map[int64]*nntp.ArticleOverview, len(numbers))
+	for i := 0; i < len(sorted); {
+		r := Range{sorted[i], sorted[i]}
+		for i++; i < len(sorted) && sorted[i] <= r.High+1; i++ {
+			r.High = sorted[i]
+		}
+		v, err := c.OverRange(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range v {
+			byNumber[int64(o.Id)] = o
+		}
+	}
+
+	rv := make([]*nntp.ArticleOverview, 0, len(byNumber))
+	for _, n := range numbers {
+		if o, ok := byNumber[n]; ok {
+			rv = append(rv, o)
+			delete(byNumber, n)
+		}
+	}
+	return rv, nil
+}
+
+// OverviewStats selects a group and checks whether the server has
+// overview data for its first and last articles, returning the group's
+// estimated article count along with the results.  Some servers have
+// gaps in their overview database; callers may want to fall back to
+// HEAD for groups where either end is missing.  Only the two endpoints
+// are requested, so it's cheap to run across many groups.
+func (c *Client) OverviewStats(group string) (count int64, lowHasOverview, highHasOverview bool, err error) {
+	g, err := c.Group(group)
+	if err != nil {
+		return 0, false, false, err
+	}
+	if g.Count == 0 || g.High < g.Low {
+		return g.Count, false, false, nil
+	}
+	first, last, err := c.overviewEnds(g)
+	if err != nil {
+		return 0, false, false, err
+	}
+	return g.Count, first != nil, last != nil, nil
+}
+
+// GroupBounds selects a group and returns the overviews of its first
+// and last articles, for showing the oldest and newest at a glance.
+// Both are nil for an empty group, and either may be nil if the server
+// has no overview for it.
+func (c *Client) GroupBounds(group string) (first, last *nntp.ArticleOverview, err error) {
+	g, err := c.Group(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.Count == 0 || g.High < g.Low {
+		return nil, nil, nil
+	}
+	return c.overviewEnds(g)
+}
+
+// overviewEnds fetches the overviews of a group's low and high
+// articles, leaving either nil if it's missing.
+func (c *Client) overviewEnds(g nntp.Group) (first, last *nntp.ArticleOverview, err error) {
+	at := func(n int64) (*nntp.ArticleOverview, error) {
+		rv, err := c.Over(n, n)
+		if len(rv) == 0 {
+			return nil, err
+		}
+		return rv[0], err
+	}
+	if first, err = at(g.Low); err != nil {
+		return nil, nil, err
+	}
+	if last, err = at(g.High); err != nil {
+		return nil, nil, err
+	}
+	return first, last, nil
+}
+
+// A PartialError reports an overview download cut off part way, such
+// as by a dropped connection.  Articles up to LastNumber were handled,
+// so the download can be resumed from LastNumber+1 (or from the start
+// of the range if LastNumber is 0) on a fresh connection.
+type PartialError struct {
+	LastNumber int64
+	Err        error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("overview interrupted after article %d: %v", e.LastNumber, e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// OverStream calls fn with the overview of each article in r as it's
+// read, without collecting them.
+//
+// If the transfer fails part way, the error is a *PartialError giving
+// the last article passed to fn.  Errors from the server's response to
+// the command, or from fn, are returned as they are.
+func (c *Client) OverStream(r Range, fn func(*nntp.ArticleOverview) error) error {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return err
+	}
+	var last int64
+	var lineErr error
+	_, err = c.overviewFunc(nil, "OVER", r.String(), func(line string) (*nntp.ArticleOverview, error) {
+		art, err := c.parseOverview(line, format)
+		if err == nil {
+			err = fn(art)
+		}
+		if err != nil {
+			lineErr = err
+			return nil, err
+		}
+		last = int64(art.Id)
+		return nil, nil
+	})
+	if err == nil || err == lineErr || errors.As(err, new(*Error)) {
+		return err
+	}
+	return &PartialError{last, err}
+}
+
+// DefaultOverChunk is the number of articles OverAll requests at a
+// time.  Some servers refuse or time out on much larger ranges.
+const DefaultOverChunk = 10000
+
+// OverAll selects a group and calls fn with the overview of each of
+// its articles, fetched in chunks of DefaultOverChunk.
+func (c *Client) OverAll(group string, fn func(*nntp.ArticleOverview) error) error {
+	return c.OverAllChunked(group, DefaultOverChunk, fn, nil)
+}
+
+// OverAllChunked is like OverAll with the given chunk size.  If
+// progress isn't nil, it's called after each chunk with the last
+// article number covered and the group's high watermark.
+func (c *Client) OverAllChunked(group string, size int64, fn func(*nntp.ArticleOverview) error, progress func(done, high int64)) error {
+	g, err := c.Group(group)
+	if err != nil {
+		return err
+	}
+	if g.High < g.Low {
+		return nil
+	}
+	for _, r := range (Range{g.Low, g.High}).Chunks(size) {
+		if err = c.OverStream(r, fn); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(r.High, g.High)
+		}
+	}
+	return nil
+}
+
+// A LineError is an overview line that couldn't be parsed.
+type LineError struct {
+	Line string
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("bad overview line %q: %v", e.Line, e.Err)
+}
+
+// OverCollect is like Over, but lines that can't be parsed are
+// returned separately rather than failing the whole batch.  Only
+// failures of the command itself are returned as err.
+func (c *Client) OverCollect(start, end int64) ([]*nntp.ArticleOverview, []LineError, error) {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var bad []LineError
+	v, err := c.overviewFunc(nil, "OVER", Range{start, end}.String(), func(line string) (*nntp.ArticleOverview, error) {
+		art, err := c.parseOverview(line, format)
+		if err != nil {
+			bad = append(bad, LineError{line, err})
+		}
+		return art, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, bad, nil
+}
+
+func (c *Client) Over(start int64, end int64) ([]*nntp.ArticleOverview, error) {
+	return c.OverRange(Range{start, end})
+}
+
+// OverRange is like Over, taking a Range, which may be open-ended.
+func (c *Client) OverRange(r Range) ([]*nntp.ArticleOverview, error) {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return nil, err
+	}
+	return c.cachedOverview("OVER", r, format)
+}
+
+// ArticlesSinceMsgID selects a group and returns the overviews of the
+// articles after the one with the given message-id, for readers that
+// remember the last article read by message-id rather than number.
+//
+// The message-id is resolved with STAT, falling back to the article's
+// Xref header for servers that give its number as 0.  If the article
+// is gone (cancelled or expired), everything from the group's low
+// water mark is returned.
+func (c *Client) ArticlesSinceMsgID(group, lastMsgID string) ([]*nntp.ArticleOverview, error) {
+	g, err := c.Group(group)
+	if err != nil {
+		return nil, err
+	}
+	from := g.Low
+	n, _, err := c.Stat(lastMsgID)
+	if err == nil && n == 0 {
+		n, err = c.xrefNumber(lastMsgID, group)
+	}
+	switch {
+	case err == nil && n > 0:
+		from = n + 1
+	case err != nil && !isNoArticle(err):
+		return nil, err
+	}
+	if g.High < from {
+		return []*nntp.ArticleOverview{}, nil
+	}
+	return c.OverRange(Range{from, -1})
+}
+
+// xrefNumber finds an article's number in group from its Xref header,
+// returning 0 if it isn't listed.
+func (c *Client) xrefNumber(msgID, group string) (int64, error) {
+	h, err := c.HeaderFields(msgID, "Xref")
+	if err != nil {
+		return 0, err
+	}
+	for _, ref := range strings.Fields(h["Xref"]) {
+		if i := strings.LastIndex(ref, ":"); i > 0 && ref[:i] == group {
+			n, _ := strconv.ParseInt(ref[i+1:], 10, 64)
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+func (c *Client) XOver(start int64, end int64) ([]*nntp.ArticleOverview, error) {
+	return c.XOverRange(Range{start, end})
+}
+
+// XOverInto is like XOver, but reuses the capacity of dst for the
+// result, which saves growing a new slice when polling the same size
+// of window repeatedly.  The returned slice aliases dst.
+func (c *Client) XOverInto(dst []*nntp.ArticleOverview, start, end int64) ([]*nntp.ArticleOverview, error) {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return nil, err
+	}
+	return c.overviewInto(dst[:0], "XOVER", Range{start, end}.String(), format)
+}
+
+// XOverRange is like XOver, taking a Range, which may be open-ended.
+func (c *Client) XOverRange(r Range) ([]*nntp.ArticleOverview, error) {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return nil, err
+	}
+	return c.cachedOverview("XOVER", r, format)
+}
+
+// OverFields is like Over, but only parses the given fields, leaving
+// the others zero.  The article number is always parsed.
+//
+// Skipping fields (particularly Date) makes building an index of a
+// large group considerably cheaper.
+func (c *Client) OverFields(start, end int64, fields ...OverHeader) ([]*nntp.ArticleOverview, error) {
+	format, err := c.overviewFormat()
+	if err != nil {
+		return nil, err
+	}
+	want := make(map[OverHeader]bool, len(fields))
+	for _, f := range fields {
+		want[f] = true
+	}
+	filtered := make([]overviewField, len(format))
+	for i, f := range format {
+		if want[f.header] {
+			filtered[i] = f
+		}
+	}
+	return c.overview("OVER", Range{start, end}.String(), filtered)
+}
+
+// hdr fetches one header for a range of articles with HDR, calling fn
+// for each article that has it.  An empty range isn't an error.
+func (c *Client) hdr(field string, r Range, fn func(n int64, value string)) error {
+	return c.hdrCommand("HDR "+field+" "+r.String(), 225, fn)
+}
+
+// hdrCommand sends a command answered with "number value" lines, such
+// as HDR or XPAT, calling fn for each non-empty value.
+func (c *Client) hdrCommand(cmd string, expectCode int, fn func(n int64, value string)) error {
+	_, _, err := c.Command(cmd, expectCode)
+	var e *Error
+	if errors.As(err, &e) && (e.Code == 423 || e.Code == 420) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.readDotLines(func(line string) error {
+		parts := strings.SplitN(line, " ", 2)
+		n, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return errors.New("Don't know how to parse HDR line: " + line)
+		}
+		if len(parts) == 2 && parts[1] != "" {
+			fn(n, parts[1])
+		}
+		return nil
+	})
+}
+
+// ErrSizeUnavailable is returned by ArticleSize when the server gives
+// no size for the article.
+var ErrSizeUnavailable = errors.New("article size unavailable")
+
+// ArticleSize returns an article's size in bytes without fetching it,
+// from the :bytes metadata item with HDR.  Servers without that fall
+// back to the Bytes header from HEAD, which some add; failing both,
+// the error is ErrSizeUnavailable.
+func (c *Client) ArticleSize(specifier string) (uint32, error) {
+	var size string
+	err := c.hdrCommand("HDR :bytes "+specifier, 225, func(_ int64, v string) {
+		size = v
+	})
+	if err != nil && !IsUnsupported(err) {
+		return 0, err
+	}
+	if size == "" {
+		h, err := c.HeaderFields(specifier, "Bytes")
+		if err != nil {
+			return 0, err
+		}
+		size = h["Bytes"]
+	}
+	if size == "" {
+		return 0, ErrSizeUnavailable
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(size), 10, 32)
+	if err != nil {
+		return 0, ErrSizeUnavailable
+	}
+	return uint32(n), nil
+}
+
+// HdrMulti fetches several headers for a range of articles, with one
+// HDR command per field, and merges them by article number.  Field
+// names in the result are canonicalized as by textproto.
+//
+// This moves far less data than HEAD for each article.  Fields the
+// server won't provide with HDR (502) are left out rather than failing
+// the call.
+func (c *Client) HdrMulti(fields []string, start, end int64) (map[int64]map[string]string, error) {
+	rv := make(map[int64]map[string]string)
+	for _, field := range fields {
+		key := textproto.CanonicalMIMEHeaderKey(field)
+		err := c.hdr(field, Range{start, end}, func(n int64, v string) {
+			if rv[n] == nil {
+				rv[n] = make(map[string]string, len(fields))
+			}
+			rv[n][key] = v
+		})
+		if errors.Is(err, ErrCommandUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+func (c *Client) articleish(cmd string, expected int) (int64, string, io.Reader, error) {
+	_, msg, err := c.Command(cmd, expected)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	parts := strings.SplitN(msg, " ", 2)
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	c.body = c.conn.DotReader()
+	return n, parts[1], c.body, nil
+}
+
+// DrainArticle discards whatever is left unread of the last article,
+// head or body returned, so a caller that loses interest part way can
+// carry on with the connection.  It does nothing if the reader was
+// already read to the end.
+func (c *Client) DrainArticle() error {
+	if c.body == nil {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, c.body)
+	c.body = nil
+	return err
+}
+
+// rawDotReader reads a dot-terminated response, undoing dot-stuffing
+// but leaving line endings exactly as sent.
+type rawDotReader struct {
+	r       *bufio.Reader
+	pending []byte
+	// At the beginning of a line.
+	bol bool
+	err error
+}
+
+func newRawDotReader(r *bufio.Reader) *rawDotReader {
+	return &rawDotReader{r: r, bol: true}
+}
+
+func (d *rawDotReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		// pending refers into the bufio buffer, which stays valid
+		// until the next read from it.
+		chunk, err := d.r.ReadSlice('\n')
+		bol := err == nil
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			d.err = io.ErrUnexpectedEOF
+		default:
+			d.err = err
+		}
+		if d.bol && len(chunk) > 0 && chunk[0] == '.' {
+			if bol && (string(chunk) == ".\r\n" || string(chunk) == ".\n") {
+				d.err = io.EOF
+				return 0, d.err
+			}
+			chunk = chunk[1:]
+		}
+		d.bol = bol
+		d.pending = chunk
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// ArticleRaw fetches an entire article, headers and body, exactly as
+// the server sent it.
+//
+// Unlike Article, which (via textproto's DotReader) turns CRLF into LF,
+// line endings are preserved.  Only dot-stuffing is undone, so the
+// result is suitable for checking signatures over the original bytes.
+// The reader must be read to the end before issuing another command.
+func (c *Client) ArticleRaw(specifier string) (io.Reader, error) {
+	_, _, err := c.Command("ARTICLE "+specifier, 220)
+	if err != nil {
+		return nil, err
+	}
+	c.body = newRawDotReader(c.conn.R)
+	return c.body, nil
+}
+
+// onceCloser makes closing a writer idempotent.
+type onceCloser struct {
+	io.WriteCloser
+	closed bool
+	err    error
+}
+
+func (w *onceCloser) Close() error {
+	if !w.closed {
+		w.closed = true
+		w.err = w.WriteCloser.Close()
+	}
+	return w.err
+}
+
+// PostWriter starts a post and returns a writer for the article, so it
+// can be generated incrementally, along with a function to finish the
+// post.
+//
+// finish closes the writer if that hasn't been done, then reads the
+// server's response, returning the message-id it reports (if any).
+// Calling it again returns the same result.  No other command may be
+// sent until finish has been called.
+func (c *Client) PostWriter() (w io.WriteCloser, finish func() (string, error), err error) {
+	if _, _, err = c.Command("POST", 340); err != nil {
+		return nil, nil, err
+	}
+	ow := &onceCloser{WriteCloser: c.conn.DotWriter()}
+	var done bool
+	var msgid string
+	var ferr error
+	finish = func() (string, error) {
+		if done {
+			return msgid, ferr
+		}
+		done = true
+		if ferr = ow.Close(); ferr != nil {
+			return "", ferr
+		}
+		var msg string
+		_, msg, ferr = readCodeLine(c.conn, 240)
+		msgid = responseMessageID(msg)
+		return msgid, ferr
+	}
+	return ow, finish, nil
+}
+
+// Post a new article
+//
+// The reader should contain the entire article, headers and body in
+// RFC822ish format.
+func (c *Client) Post(r io.Reader) error {
+	_, err := c.post(r)
+	return err
+}
+
+// post does the work of Post, returning the text of the 240 response.
+func (c *Client) post(r io.Reader) (string, error) {
+	_, _, err := c.Command("POST", 340)
+	if err != nil {
+		return "", err
+	}
+	// The dot writer ends an unterminated last line with CRLF before
+	// the terminating dot, so the article needn't end with a newline.
+	w := c.conn.DotWriter()
+	_, err = io.Copy(w, r)
+	if err != nil {
+		// This seems really bad
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	_, msg, err := readCodeLine(c.conn, 240)
+	return msg, err
+}
+
+// A PostResult is the outcome of posting one article with PostMany.
+type PostResult struct {
+	// The article's Message-ID, from its headers or the server's
+	// response.  May be empty if neither provided one.
+	MessageID string
+	Err       error
+}
+
+// ErrDuplicateMessageID is matched (with errors.Is) by the
+// *DuplicateMessageIDError for an article reusing a Message-ID.
+var ErrDuplicateMessageID = errors.New("duplicate message-id in batch")
+
+// A DuplicateMessageIDError names a Message-ID used by more than one
+// article in a batch.  The later articles aren't sent.
+type DuplicateMessageIDError struct {
+	MessageID string
+}
+
+func (e *DuplicateMessageIDError) Error() string {
+	return ErrDuplicateMessageID.Error() + ": " + e.MessageID
+}
+
+func (e *DuplicateMessageIDError) Unwrap() error {
+	return ErrDuplicateMessageID
+}
+
+// batchIDs tracks the Message-IDs seen in a batch, if the client is
+// configured to detect duplicates.
+type batchIDs map[string]bool
+
+func (c *Client) newBatchIDs() batchIDs {
+	if !c.config.DetectDuplicateIDs {
+		return nil
+	}
+	return make(batchIDs)
+}
+
+// check records id, returning a *DuplicateMessageIDError if it's been
+// seen before.  Articles without an id aren't checked.
+func (b batchIDs) check(id string) error {
+	if b == nil || id == "" {
+		return nil
+	}
+	if b[id] {
+		return &DuplicateMessageIDError{id}
+	}
+	b[id] = true
+	return nil
+}
+
+// responseMessageID finds a <message-id> in a response line.
+func responseMessageID(msg string) string {
+	for _, f := range strings.Fields(msg) {
+		if validMessageID(f) {
+			return f
+		}
+	}
+	return ""
+}
+
+// PostMany posts articles one after another, collecting the outcome of
+// each.
+//
+// Articles the server rejects (441), and duplicates caught with
+// Config.DetectDuplicateIDs, are recorded in their PostResult and
+// posting continues.  Any other failure stops the batch; the results
+// so far are returned along with the error.
+func (c *Client) PostMany(articles []io.Reader) ([]PostResult, error) {
+	rv := make([]PostResult, 0, len(articles))
+	seen := c.newBatchIDs()
+	var buf bytes.Buffer
+	for _, a := range articles {
+		buf.Reset()
+		if _, err := buf.ReadFrom(a); err != nil {
+			return rv, err
+		}
+		var res PostResult
+		if h, err := readHeader(bytes.NewReader(buf.Bytes())); err == nil {
+			res.MessageID = h.Get("Message-Id")
+		}
+		if res.Err = seen.check(res.MessageID); res.Err != nil {
+			rv = append(rv, res)
+			continue
+		}
+
+		var msg string
+		msg, res.Err = c.post(&buf)
+		if res.MessageID == "" {
+			res.MessageID = responseMessageID(msg)
+		}
+		rv = append(rv, res)
+		if res.Err != nil && !errors.Is(res.Err, errPostingFailed) {
+			return rv, res.Err
+		}
+	}
+	return rv, nil
+}
+
+// ErrVerificationPending is returned by PostAndVerify when a posted
+// article isn't (yet) found on the server.  The post itself succeeded;
+// the article may just not have propagated.
+var ErrVerificationPending = errors.New("posted article not yet available")
+
+// PostAndVerify posts an article, then checks with STAT that the server
+// has it.
+//
+// The message-id comes from the article's Message-ID header, or else
+// from the server's response.  If neither gives one, the article is
+// posted but can't be verified.
+func (c *Client) PostAndVerify(r io.Reader) (msgid string, verified bool, err error) {
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(r); err != nil {
+		return "", false, err
+	}
+	if h, herr := readHeader(bytes.NewReader(buf.Bytes())); herr == nil {
+		msgid = h.Get("Message-Id")
+	}
+	msg, err := c.post(&buf)
+	if err != nil {
+		return msgid, false, err
+	}
+	if msgid == "" {
+		msgid = responseMessageID(msg)
+	}
+	if msgid == "" {
+		return "", false, nil
+	}
+
+	_, _, err = c.Stat(msgid)
+	if isNoArticle(err) {
+		return msgid, false, ErrVerificationPending
+	}
+	return msgid, err == nil, err
+}
+
+// readHeader parses a header block such as the one returned by HEAD.
+func readHeader(r io.Reader) (textproto.MIMEHeader, error) {
+	h, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	// HEAD responses end without the blank separator line.
+	if err == io.EOF {
+		err = nil
+	}
+	return h, err
+}
+
+// validMessageID does a basic sanity check of a <local@domain> id.
+func validMessageID(id string) bool {
+	return len(id) > 2 && id[0] == '<' && id[len(id)-1] == '>' &&
+		strings.Contains(id, "@") && !strings.ContainsAny(id, " \t\r\n")
+}
+
+// messageIDSeq keeps message-ids generated in the same nanosecond
+// distinct, even if the random part were to collide.
+var messageIDSeq uint64
+
+// newMessageID generates a unique message-id in the given domain.
+func newMessageID(domain string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("<%d.%d.%s@%s>", time.Now().UnixNano(),
+		atomic.AddUint64(&messageIDSeq, 1), hex.EncodeToString(b[:]), domain)
+}
+
+// validMessageIDDomain reports whether domain is usable as the right
+// hand side of a message-id: dot-separated labels of letters, digits,
+// hyphens and underscores.
+func validMessageIDDomain(domain string) bool {
+	if domain == "" {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+				r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// messageIDDomain returns the domain for generated message-ids: the
+// configured MessageIDDomain, or else the domain of the from address,
+// which may be in any RFC 5322 form ("Name <addr>", "addr (comment)").
+func (c *Client) messageIDDomain(from string) (string, error) {
+	domain := c.config.MessageIDDomain
+	if domain == "" {
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return "", fmt.Errorf("invalid from address %q: %w", from, err)
+		}
+		domain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	}
+	if !validMessageIDDomain(domain) {
+		return "", fmt.Errorf("invalid message-id domain %q", domain)
+	}
+	return domain, nil
+}
+
+// Cancel an article by posting a cancel control message for it.
+//
+// The control message is posted to the original article's newsgroups
+// if the server still has it, or to control.cancel otherwise.  from is
+// the poster address and must match the original article's sender for
+// most servers to honor the cancel.
+func (c *Client) Cancel(msgid, from string) error {
+	if !validMessageID(msgid) {
+		return fmt.Errorf("invalid message-id %q", msgid)
+	}
+	at := strings.LastIndex(from, "@")
+	if at < 0 || strings.ContainsAny(from, "\r\n") {
+		return fmt.Errorf("invalid from address %q", from)
+	}
+	domain, err := c.messageIDDomain(from)
+	if err != nil {
+		return err
+	}
+
+	newsgroups := "control.cancel"
+	_, _, r, err := c.Head(msgid)
+	switch err.(type) {
+	case nil:
+		h, err := readHeader(r)
+		if err != nil {
+			return err
+		}
+		if ng := h.Get("Newsgroups"); ng != "" {
+			newsgroups = ng
+		}
+	case *Error:
+	default:
+		return err
+	}
+
+	var art bytes.Buffer
+	fmt.Fprintf(&art, "From: %s\r\n", from)
+	fmt.Fprintf(&art, "Newsgroups: %s\r\n", newsgroups)
+	fmt.Fprintf(&art, "Subject: cmsg cancel %s\r\n", msgid)
+	fmt.Fprintf(&art, "Control: cancel %s\r\n", msgid)
+	fmt.Fprintf(&art, "Message-ID: %s\r\n", newMessageID(domain))
+	fmt.Fprintf(&art, "Date: %s\r\n", c.clock().Format(time.RFC1123Z))
+	fmt.Fprintf(&art, "\r\n")
+	fmt.Fprintf(&art, "Cancel of %s\r\n", msgid)
+	return c.Post(&art)
+}
+
+// Date returns the server's current time (UTC).
+func (c *Client) Date() (time.Time, error) {
+	_, msg, err := c.Command("DATE", 111)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse("20060102150405", strings.TrimSpace(msg))
+}
+
+// NewNews lists the message-ids of articles in groups matching a
+// wildmat that arrived since the given time.
+func (c *Client) NewNews(wildmat string, since time.Time) ([]string, error) {
+	cmd := fmt.Sprintf("NEWNEWS %s %s GMT", wildmat, since.UTC().Format("20060102 150405"))
+	if _, _, err := c.Command(cmd, 230); err != nil {
+		return nil, err
+	}
+	rv := []string{}
+	err := c.readDotLines(func(line string) error {
+		if id := strings.TrimSpace(line); id != "" {
+			rv = append(rv, id)
+		}
+		return nil
+	})
+	return rv, err
+}
+
+// ComputePollWindow returns the time to ask NewNews for articles since,
+// given the time of the last poll.  Going back by overlap avoids
+// missing articles that arrive out of order or are stamped by a clock
+// that's slightly behind, at the cost of seeing some twice.  The
+// result is never after now.
+func ComputePollWindow(lastPoll time.Time, overlap time.Duration, now time.Time) (since time.Time) {
+	since = lastPoll.Add(-overlap)
+	if since.After(now) {
+		since = now
+	}
+	return since
+}
+
+// ClockDrift returns how far the server's clock is ahead of the local
+// one (negative if it's behind).  DATE only has a resolution of a
+// second, so smaller differences aren't significant.
+func (c *Client) ClockDrift() (time.Duration, error) {
+	t, err := c.Date()
+	if err != nil {
+		return 0, err
+	}
+	return t.Sub(c.clock()), nil
+}
+
+// Command sends a low-level command and get a response.
+//
+// This will return an error if the code doesn't match the expectCode
+// prefix.  For example, if you specify "200", the response code MUST
+// be 200 or you'll get an error.  If you specify "2", any code from
+// 200 (inclusive) to 300 (exclusive) will be success.  An expectCode
+// of -1 disables this behavior.
+//
+// If the server asks for authentication (480) and the client was
+// configured with AutoReauth, it authenticates again with the last
+// credentials and retries the command once.  Otherwise responses
+// needing authentication, encryption (483) or a change of mode (401)
+// are returned as a *CommandError naming the command.
+func (c *Client) Command(cmd string, expectCode int) (int, string, error) {
+	code, msg, err := c.command(cmd, expectCode)
+	if !errors.Is(err, ErrAuthRequired) && !errors.Is(err, ErrSecureConnectionRequired) &&
+		!errors.Is(err, ErrWrongMode) {
+		return code, msg, err
+	}
+	if errors.Is(err, ErrAuthRequired) && c.config.AutoReauth && c.user != "" && !c.reauthing {
+		c.reauthing = true
+		_, aerr := c.Authenticate(c.user, c.pass)
+		c.reauthing = false
+		if aerr == nil {
+			code, msg, err = c.command(cmd, expectCode)
+		}
+	}
+	if err != nil {
+		err = &CommandError{cmd, err}
+	}
+	return code, msg, err
+}
+
+// queueCommand writes a command line without flushing it, so several
+// pipelined commands go out together.  Reading a response, or Flush,
+// sends them.
+func (c *Client) queueCommand(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(c.conn.W, format+"\r\n", args...)
+	return err
+}
+
+// Flush sends any buffered commands to the server.  Commands sent with
+// the usual methods are flushed immediately; this is only needed after
+// writing pipelined commands directly.
+func (c *Client) Flush() error {
+	return c.conn.W.Flush()
+}
+
+func (c *Client) command(cmd string, expectCode int) (int, string, error) {
+	err := c.conn.PrintfLine("%s", cmd)
+	if err != nil {
+		return 0, "", err
+	}
+	return readCodeLine(c.conn, expectCode)
+}
+
+// CommandExpect is like Command, but succeeds only if the response code
+// is one of accept.  Any other response is returned as an *Error along
+// with its code and message.
+func (c *Client) CommandExpect(cmd string, accept ...int) (int, string, error) {
+	code, msg, err := c.Command(cmd, -1)
+	if err != nil {
+		return code, msg, err
+	}
+	for _, a := range accept {
+		if code == a {
+			return code, msg, nil
+		}
+	}
+	return code, msg, &Error{Code: code, Msg: msg}
+}
+
+// dotReadCloser drains the rest of a multi-line response on Close.
+type dotReadCloser struct {
+	io.Reader
+}
+
+func (d dotReadCloser) Close() error {
+	_, err := io.Copy(io.Discard, d.Reader)
+	return err
+}
+
+// CommandReader sends a command with a multi-line response and returns
+// the dot-unstuffed body as a stream.
+//
+// The expectCode is interpreted as in Command.  The reader must be read
+// to the end or closed before issuing another command; Close discards
+// whatever is left of the response.
+func (c *Client) CommandReader(cmd string, expectCode int) (io.ReadCloser, error) {
+	_, _, err := c.Command(cmd, expectCode)
+	if err != nil {
+		return nil, err
+	}
+	return dotReadCloser{c.conn.DotReader()}, nil
 }
@@ -6,7 +6,15 @@ import (
 	"testing"
 	//	"encoding/hex"
 	"errors"
+	"io"
+	"math"
+	"net"
+	"net/textproto"
+	"reflect"
 	"strings"
+	"time"
+
+	"github.com/knothon/go-nntp"
 )
 
 type stubResponse struct {
@@ -14,31 +22,54 @@ type stubResponse struct {
 	ResponseMsg  string
 	HasPayload   bool
 	Payload      []string
+	// Sent verbatim after the response line.
+	Raw string
 }
+
+// stubReaderWriter answers commands with prepared responses.  Responses
+// prepared more than once for the same command are served in order,
+// with the last one repeating.
+//
+// A 335 or 340 response puts the stub into a data phase where
+// everything up to the terminating dot line is recorded in
+// receivedArticles, and the next response for the same command is
+// sent once the data is complete.  TAKETHIS starts the data phase
+// straight away, as the article follows the command unprompted.
 type stubReaderWriter struct {
 	receivedRequests []string
-	responses        map[string]*stubResponse
-	buffer           bytes.Buffer
+	receivedLines    []string
+	receivedArticles []string
+	responses        map[string][]*stubResponse
+	in               bytes.Buffer
+	out              bytes.Buffer
+	dataFor          string
 }
 
 func NewStub(responseCode int, banner string) *stubReaderWriter {
-	res := &stubReaderWriter{responses: make(map[string]*stubResponse)}
-	res.buffer.WriteString(fmt.Sprintf("%v %v\r\n", responseCode, banner))
+	res := &stubReaderWriter{responses: make(map[string][]*stubResponse)}
+	res.out.WriteString(fmt.Sprintf("%v %v\r\n", responseCode, banner))
 	return res
 }
 
 func (s *stubReaderWriter) PrepareDotPayloadResponseArray(command string, responseCode int, responseMsg string, payload []string) {
 	response := &stubResponse{ResponseCode: responseCode, ResponseMsg: responseMsg, HasPayload: true, Payload: payload}
-	s.responses[command] = response
+	s.responses[command] = append(s.responses[command], response)
 }
 
 func (s *stubReaderWriter) PrepareDotPayloadResponse(command string, responseCode int, responseMsg string, payload ...string) {
 	response := &stubResponse{ResponseCode: responseCode, ResponseMsg: responseMsg, HasPayload: true, Payload: payload}
-	s.responses[command] = response
+	s.responses[command] = append(s.responses[command], response)
 }
 func (s *stubReaderWriter) PrepareResponse(command string, responseCode int, responseMsg string) {
 	response := &stubResponse{ResponseCode: responseCode, ResponseMsg: responseMsg, HasPayload: false}
-	s.responses[command] = response
+	s.responses[command] = append(s.responses[command], response)
+}
+
+// PrepareRawResponse sends raw exactly as given after the response
+// line, which must include any dot-stuffing and terminator.
+func (s *stubReaderWriter) PrepareRawResponse(command string, responseCode int, responseMsg string, raw string) {
+	response := &stubResponse{ResponseCode: responseCode, ResponseMsg: responseMsg, Raw: raw}
+	s.responses[command] = append(s.responses[command], response)
 }
 
 func (s *stubReaderWriter) Close() error {
@@ -46,47 +77,105 @@ func (s *stubReaderWriter) Close() error {
 }
 
 func (s *stubReaderWriter) Read(p []byte) (n int, err error) {
-	return s.buffer.Read(p)
+	return s.out.Read(p)
 }
 
 func (s *stubReaderWriter) Write(p []byte) (n int, err error) {
-	n, err = s.buffer.Write(p)
+	n, err = s.in.Write(p)
 	//	fmt.Println(hex.EncodeToString(p))
 	if err != nil {
 		return
 	}
 
-	l := len(p)
-	if p[l-2] == 0x0d && p[l-1] == 0x0a {
-		line := strings.TrimSpace(s.buffer.String())
-		s.buffer.Reset()
+	for {
+		data := s.in.Bytes()
+		if s.dataFor != "" {
+			end := bytes.Index(data, []byte("\r\n.\r\n"))
+			if end < 0 {
+				return
+			}
+			s.receivedArticles = append(s.receivedArticles, string(data[:end+2]))
+			s.in.Next(end + 5)
+			cmd := s.dataFor
+			s.dataFor = ""
+			if err = s.respond(cmd); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		end := bytes.Index(data, []byte("\r\n"))
+		if end < 0 {
+			return
+		}
+		line := strings.TrimSpace(string(data[:end]))
+		s.in.Next(end + 2)
 		cmd := strings.Split(line, " ")[0]
 		//		fmt.Println(cmd)
-		resp, exists := s.responses[cmd]
-
 		s.receivedRequests = append(s.receivedRequests, cmd)
-
-		if !exists {
-			return 0, errors.New("Unknown command")
+		s.receivedLines = append(s.receivedLines, line)
+		if cmd == "TAKETHIS" {
+			s.dataFor = cmd
+			continue
 		}
-
-		s.buffer.WriteString(fmt.Sprintf("%v %v\r\n", resp.ResponseCode, resp.ResponseMsg))
-		if resp.HasPayload {
-			for _, line := range resp.Payload {
-				s.buffer.WriteString(line)
-				s.buffer.WriteString("\r\n")
-			}
-			s.buffer.WriteString(".\r\n")
+		// Responses may also be prepared for a whole command line.
+		if _, ok := s.responses[line]; ok {
+			cmd = line
+		}
+		if err = s.respond(cmd); err != nil {
+			return 0, err
 		}
 	}
+}
+
+func (s *stubReaderWriter) respond(cmd string) error {
+	queue := s.responses[cmd]
+	if len(queue) == 0 {
+		return errors.New("Unknown command")
+	}
+	resp := queue[0]
+	if len(queue) > 1 {
+		s.responses[cmd] = queue[1:]
+	}
 
-	return
+	s.out.WriteString(fmt.Sprintf("%v %v\r\n", resp.ResponseCode, resp.ResponseMsg))
+	if resp.HasPayload {
+		for _, line := range resp.Payload {
+			s.out.WriteString(line)
+			s.out.WriteString("\r\n")
+		}
+		s.out.WriteString(".\r\n")
+	}
+	s.out.WriteString(resp.Raw)
+	if resp.ResponseCode == 335 || resp.ResponseCode == 340 {
+		s.dataFor = cmd
+	}
+	return nil
 }
 
 func HasReceivedRequest(s *stubReaderWriter, command string) bool {
+	return CountReceivedRequests(s, command) > 0
+}
+
+func HasReceivedLine(s *stubReaderWriter, line string) bool {
+	for _, l := range s.receivedLines {
+		if l == line {
+			return true
+		}
+	}
 	return false
 }
 
+func CountReceivedRequests(s *stubReaderWriter, command string) int {
+	n := 0
+	for _, r := range s.receivedRequests {
+		if r == command {
+			n++
+		}
+	}
+	return n
+}
+
 func TestCapabilities(t *testing.T) {
 
 	stub := NewStub(200, "Stub")
@@ -113,6 +202,33 @@ func TestCapabilities(t *testing.T) {
 	}
 }
 
+func TestCapabilitiesParsed(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER", "compress DEFLATE SHRINK", "LIST ACTIVE NEWSGROUPS")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caps, err := cli.CapabilitiesParsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := caps["READER"]; !ok {
+		t.Errorf("Expected READER in %v", caps)
+	}
+	if args := caps["LIST"]; len(args) != 2 || args[1] != "NEWSGROUPS" {
+		t.Errorf("Expected LIST arguments, got %v", args)
+	}
+	if err = cli.supportsCompression("deflate"); err != nil {
+		t.Errorf("Expected DEFLATE to be supported, got %v", err)
+	}
+	if err = cli.supportsCompression("GZIP"); err != ErrCompressionNotSupported {
+		t.Errorf("Expected ErrCompressionNotSupported, got %v", err)
+	}
+}
+
 func BenchmarkXover(b *testing.B) {
 	stub := NewStub(200, "Stub")
 
@@ -145,6 +261,141 @@ func BenchmarkXover(b *testing.B) {
 
 }
 
+// overviewStub answers LIST OVERVIEW.FMT with the format used by
+// overBenchStub, leaving OVER for the test to prepare.
+func overviewStub() *stubReaderWriter {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "List Format:", "Subject:",
+		"From:",
+		"Date:", "Message-ID:",
+		"References:",
+		":bytes",
+		":lines",
+		"Xref:full")
+	return stub
+}
+
+func overBenchStub(n int) *stubReaderWriter {
+	stub := overviewStub()
+
+	var payload []string
+	for i := 0; i < n; i++ {
+		line := fmt.Sprintf("%v\t[Orphan] Hoshi Neko Full House [1/6] - \"[Orphan] Hoshi Neko Full House - 04 [727A998C].mkv\" yEnc (111/375) 268407965	Anime Tosho <usenet.bot@animetosho.org>	Tue, 28 Nov 2017 20:09:05 GMT\t<XdJjUkOaTsTlNfFfBjWdOfWz-1511899745978@nyuu>		741002	5695	Xref: news.usenetserver.com alt.binaries.multimedia.anime.highspeed:382401874", i)
+		payload = append(payload, line)
+	}
+
+	stub.PrepareDotPayloadResponseArray("OVER", 224, "Overview:", payload)
+	return stub
+}
+
+// xoverPollStub answers the given number of XOVER polls, each with a
+// window of n articles.
+func xoverPollStub(polls, n int) *stubReaderWriter {
+	stub := overBenchStub(n)
+	payload := stub.responses["OVER"][0].Payload
+	for i := 0; i < polls; i++ {
+		stub.PrepareDotPayloadResponseArray("XOVER", 224, "Overview:", payload)
+	}
+	return stub
+}
+
+func BenchmarkXOverPoll(b *testing.B) {
+	cli, err := NewConn(xoverPollStub(b.N, 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err = cli.XOver(0, 99); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkXOverIntoPoll(b *testing.B) {
+	cli, err := NewConn(xoverPollStub(b.N, 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var v []*nntp.ArticleOverview
+	for i := 0; i < b.N; i++ {
+		if v, err = cli.XOverInto(v, 0, 99); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestXOverInto(t *testing.T) {
+	cli, err := NewConn(xoverPollStub(2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]*nntp.ArticleOverview, 5, 10)
+	v, err := cli.XOverInto(dst, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 3 || &v[:cap(v)][0] != &dst[:cap(dst)][0] {
+		t.Fatalf("Expected 3 results reusing dst, got %v", len(v))
+	}
+	if v[2].Id != 2 {
+		t.Errorf("Unexpected last article: %#v", v[2])
+	}
+}
+
+func BenchmarkOverAllFields(b *testing.B) {
+	cli, err := NewConn(overBenchStub(b.N))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	if _, err = cli.Over(0, int64(b.N)); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkOverFields(b *testing.B) {
+	cli, err := NewConn(overBenchStub(b.N))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	_, err = cli.OverFields(0, int64(b.N), OverHeaderSubject, OverHeaderMsgId)
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestOverFields(t *testing.T) {
+	cli, err := NewConn(overBenchStub(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cli.OverFields(0, 2, OverHeaderSubject, OverHeaderMsgId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("Expected 3 overviews, got %v", len(res))
+	}
+	o := res[2]
+	if o.Id != 2 || o.MessageId != "<XdJjUkOaTsTlNfFfBjWdOfWz-1511899745978@nyuu>" ||
+		!strings.HasPrefix(o.Subject, "[Orphan]") {
+		t.Fatalf("Requested fields not set: %#v", o)
+	}
+	if o.From != "" || !o.Date.IsZero() || o.Bytes != 0 || o.XRef != "" {
+		t.Fatalf("Unrequested fields set: %#v", o)
+	}
+}
+
 func TestXzver(t *testing.T) {
 	stub := NewStub(200, "Stub")
 	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
@@ -170,3 +421,2510 @@ func TestParseDate(t *testing.T) {
 	}
 
 }
+
+func TestListActive(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list of newsgroups follows",
+		"misc.test 3002322 3000234 y",
+		"comp.lang.go 1024 1 m")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := cli.List("ACTIVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %v", len(groups))
+	}
+	g := groups[0]
+	if g.Name != "misc.test" || g.High != 3002322 || g.Low != 3000234 {
+		t.Fatalf("Incorrect high/low mapping: %#v", g)
+	}
+	if g.Estimated() != 2089 {
+		t.Fatalf("Expected estimate 2089, got %v", g.Estimated())
+	}
+	if groups[1].Posting != nntp.PostingModerated {
+		t.Fatalf("Expected moderated, got %v", groups[1].Posting)
+	}
+}
+
+func TestGroupStat(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "1234 3000234 3002322 misc.test")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	low, high, estimate, err := cli.GroupStat("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if low != 3000234 || high != 3002322 || estimate != 1234 {
+		t.Fatalf("Got low=%v high=%v estimate=%v", low, high, estimate)
+	}
+}
+
+func TestGroupStatEmpty(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "0 3000 2999 misc.empty")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	low, high, estimate, err := cli.GroupStat("misc.empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if low != 3000 || high != 2999 || estimate != 0 {
+		t.Fatalf("Got low=%v high=%v estimate=%v", low, high, estimate)
+	}
+}
+
+func TestGroupThenNext(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "3 10 12 misc.test")
+	stub.PrepareResponse("NEXT", 223, "11 <b@x> article retrieved")
+	stub.PrepareResponse("STAT", 223, "11 <b@x> article retrieved")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := cli.Next(); !errors.Is(err, ErrNoCurrentArticle) {
+		t.Fatalf("Expected ErrNoCurrentArticle before GROUP, got %v", err)
+	}
+	if _, err := cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	n, id, err := cli.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || id != "<b@x>" {
+		t.Fatalf("Got %v %v", n, id)
+	}
+	if n, _, err = cli.Stat(""); err != nil || n != 11 {
+		t.Fatalf("Got %v, %v", n, err)
+	}
+	if stub.receivedLines[len(stub.receivedLines)-1] != "STAT" {
+		t.Errorf("Expected a bare STAT, got %q", stub.receivedLines)
+	}
+}
+
+func TestGroupEmptyNoCurrentArticle(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "0 3000 2999 misc.empty")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Group("misc.empty"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cli.Last(); !errors.Is(err, ErrNoCurrentArticle) {
+		t.Fatalf("Expected ErrNoCurrentArticle, got %v", err)
+	}
+	if HasReceivedRequest(stub, "LAST") {
+		t.Error("Expected LAST not to be sent")
+	}
+}
+
+func TestOverNoOverviewFormat(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"1\tsubject\tfrom")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Over(1, 1)
+	if err != ErrNoOverviewFormat {
+		t.Fatalf("Expected ErrNoOverviewFormat, got %v", err)
+	}
+}
+
+func TestOverOverviewFormatUnavailable(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("LIST", 503, "Not supported")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.XOver(1, 1)
+	if err != ErrNoOverviewFormat {
+		t.Fatalf("Expected ErrNoOverviewFormat, got %v", err)
+	}
+}
+
+func TestCapabilitiesRefreshedAfterAuth(t *testing.T) {
+	stub := NewStub(201, "Stub, posting prohibited")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER", "POST")
+	stub.PrepareResponse("authinfo", 381, "Password required")
+	stub.PrepareResponse("authinfo", 281, "Welcome")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.PostingAllowed {
+		t.Fatal("Expected posting to be prohibited by the banner")
+	}
+
+	if _, err = cli.Capabilities(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Capabilities(); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "CAPABILITIES"); n != 1 {
+		t.Fatalf("Expected cached capabilities, got %v requests", n)
+	}
+
+	if _, err = cli.Authenticate("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := cli.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "CAPABILITIES"); n != 2 {
+		t.Fatalf("Expected capabilities to be re-fetched, got %v requests", n)
+	}
+	if len(caps) != 3 || !cli.PostingAllowed {
+		t.Fatalf("Expected POST after auth, got %v (posting=%v)",
+			caps, cli.PostingAllowed)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <orig@example.com>",
+		"From: me@example.com",
+		"Newsgroups: misc.test,alt.test",
+		"Subject: oops")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cli.Cancel("<orig@example.com>", "me@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.receivedArticles) != 1 {
+		t.Fatalf("Expected one posted article, got %v", len(stub.receivedArticles))
+	}
+	art := stub.receivedArticles[0]
+	for _, want := range []string{
+		"Control: cancel <orig@example.com>\r\n",
+		"Newsgroups: misc.test,alt.test\r\n",
+		"From: me@example.com\r\n",
+		"Subject: cmsg cancel <orig@example.com>\r\n",
+		"@example.com>\r\n",
+	} {
+		if !strings.Contains(art, want) {
+			t.Errorf("Expected %q in cancel article:\n%s", want, art)
+		}
+	}
+
+	if err = cli.Cancel("orig@example.com", "me@example.com"); err == nil {
+		t.Error("Expected error for invalid message-id")
+	}
+	if err = cli.Cancel("<orig@example.com>", "nobody"); err == nil {
+		t.Error("Expected error for invalid from")
+	}
+}
+
+func TestCancelDateUsesClock(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("HEAD", 430, "No such article")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := time.FixedZone("", -5*60*60)
+	cli.SetClock(func() time.Time {
+		return time.Date(2019, 1, 3, 18, 58, 44, 0, zone)
+	})
+
+	if err = cli.Cancel("<orig@example.com>", "me@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Date: Thu, 03 Jan 2019 18:58:44 -0500\r\n"
+	if !strings.Contains(stub.receivedArticles[0], want) {
+		t.Errorf("Expected %q in:\n%s", want, stub.receivedArticles[0])
+	}
+}
+
+func TestClockDrift(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 13:59:14 at UTC-5 is 18:59:14 UTC, 30s after the server's time.
+	zone := time.FixedZone("", -5*60*60)
+	cli.SetClock(func() time.Time {
+		return time.Date(2019, 1, 3, 13, 59, 14, 0, zone)
+	})
+
+	d, err := cli.ClockDrift()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != -30*time.Second {
+		t.Errorf("Expected -30s drift, got %v", d)
+	}
+}
+
+func TestCountArticles(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "7 1 10 misc.test")
+	stub.PrepareDotPayloadResponse("LISTGROUP", 211, "5 1 10 misc.test list follows",
+		"1", "2", "5", "9", "10")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := cli.CountArticles("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("Expected estimate 7, got %v", n)
+	}
+
+	n, err = cli.CountArticlesExact("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("Expected exact count 5, got %v", n)
+	}
+}
+
+func TestListGroupRangePaging(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LISTGROUP", 211, "6 100 110 misc.test list follows",
+		"100", "101", "103", "104")
+	// The second page runs past the end of the group.
+	stub.PrepareDotPayloadResponse("LISTGROUP", 211, "6 100 110 misc.test list follows",
+		"108", "110")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages [][]int64
+	for _, r := range (Range{100, 115}).Chunks(8) {
+		page, err := cli.ListGroupRange("misc.test", r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+	want := [][]int64{{100, 101, 103, 104}, {108, 110}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, pages)
+	}
+	lines := "LISTGROUP misc.test 100-107|LISTGROUP misc.test 108-115"
+	if got := strings.Join(stub.receivedLines, "|"); got != lines {
+		t.Errorf("Expected %q, got %q", lines, got)
+	}
+}
+
+func TestAuthenticateSecureConnectionRequired(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("authinfo", 483, "Encryption required")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Authenticate("user", "pass")
+	if !errors.Is(err, ErrSecureConnectionRequired) {
+		t.Fatalf("Expected ErrSecureConnectionRequired, got %v", err)
+	}
+	if err.Error() != "483 Encryption required" {
+		t.Fatalf("Expected the server's message, got %q", err.Error())
+	}
+	var terr *textproto.Error
+	if !errors.As(err, &terr) || terr.Code != 483 {
+		t.Fatalf("Expected a textproto error with code 483, got %v", terr)
+	}
+	if n := CountReceivedRequests(stub, "authinfo"); n != 1 {
+		t.Fatalf("Expected no password to be sent, got %v requests", n)
+	}
+}
+
+func TestAuthenticateUserOnly(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("authinfo", 281, "Authentication accepted")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := cli.Authenticate("user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "Authentication accepted" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+	if n := CountReceivedRequests(stub, "authinfo"); n != 1 {
+		t.Errorf("Expected no password to be sent, got %v requests", n)
+	}
+}
+
+func TestAuthGeneric(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("AUTHINFO", 381, "nonce-1")
+	stub.PrepareResponse("reply-nonce-1", 381, "nonce-2")
+	stub.PrepareResponse("reply-nonce-2", 281, "Authentication accepted")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "POST")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var challenges []string
+	err = cli.AuthGeneric("ticket", func(challenge string) (string, error) {
+		challenges = append(challenges, challenge)
+		return "reply-" + challenge, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(challenges, ",") != "nonce-1,nonce-2" {
+		t.Errorf("Unexpected challenges: %q", challenges)
+	}
+	if stub.receivedLines[0] != "AUTHINFO GENERIC ticket" {
+		t.Errorf("Unexpected command: %q", stub.receivedLines[0])
+	}
+	if !cli.PostingAllowed {
+		t.Error("Expected posting to be allowed after authenticating")
+	}
+}
+
+func TestAuthGenericRejected(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("AUTHINFO", 381, "nonce")
+	stub.PrepareResponse("wrong", 481, "Authentication failed")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.AuthGeneric("ticket", func(string) (string, error) {
+		return "wrong", nil
+	})
+	if !errors.Is(err, ErrAuthRejected) {
+		t.Fatalf("Expected ErrAuthRejected, got %v", err)
+	}
+}
+
+func TestOverCollect(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"1\tone\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1",
+		"two\tbad number\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1",
+		"3\tthree\ta@x\tnot a date\t<3@x>\t\t10\t1",
+		"4\tfour\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<4@x>\t\t10\t1")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, bad, err := cli.OverCollect(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 || v[0].Id != 1 || v[1].Id != 4 {
+		t.Errorf("Expected articles 1 and 4, got %v", v)
+	}
+	if len(bad) != 2 || !strings.HasPrefix(bad[0].Line, "two\t") ||
+		!strings.HasPrefix(bad[1].Line, "3\t") {
+		t.Errorf("Unexpected line errors: %v", bad)
+	}
+	for _, e := range bad {
+		if e.Err == nil {
+			t.Errorf("Expected a parse error for %q", e.Line)
+		}
+	}
+}
+
+func TestOverAllChunks(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "5 1 5 misc.test")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"1\tone", "2\ttwo", "3\tthree")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"4\tfour", "5\tfive")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subjects []string
+	var done []int64
+	err = cli.OverAllChunked("misc.test", 3, func(o *nntp.ArticleOverview) error {
+		subjects = append(subjects, o.Subject)
+		return nil
+	}, func(n, high int64) {
+		if high != 5 {
+			t.Errorf("Expected high 5, got %v", high)
+		}
+		done = append(done, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(subjects, ",") != "one,two,three,four,five" {
+		t.Errorf("Unexpected subjects: %q", subjects)
+	}
+	if fmt.Sprint(done) != "[3 5]" {
+		t.Errorf("Unexpected progress: %v", done)
+	}
+	want := "GROUP misc.test|LIST OVERVIEW.FMT|OVER 1-3|OVER 4-5"
+	if got := strings.Join(stub.receivedLines, "|"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestOverNumbers(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"3\tthree", "5\tfive")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"10\tten")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := cli.OverNumbers([]int64{5, 3, 4, 10, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range v {
+		got = append(got, o.Subject)
+	}
+	if strings.Join(got, ",") != "five,three,ten" {
+		t.Errorf("Unexpected results: %q", got)
+	}
+	want := "LIST OVERVIEW.FMT|OVER 3-5|OVER 10"
+	if lines := strings.Join(stub.receivedLines, "|"); lines != want {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+}
+
+func TestReadDotLinesUnstuffing(t *testing.T) {
+	raw := "..leading\r\n...\r\n.\tx\r\nplain.\r\n.\r\n"
+	stub := NewStub(200, "Stub")
+	stub.PrepareRawResponse("OVER", 224, "Overview follows", raw)
+	stub.PrepareRawResponse("XOVER", 224, "Overview follows", raw)
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = cli.Command("OVER", 224); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = cli.readDotLines(func(line string) error {
+		got = append(got, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = cli.Command("XOVER", 224); err != nil {
+		t.Fatal(err)
+	}
+	want, err := cli.conn.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q as from textproto, got %q", want, got)
+	}
+	if len(got) != 4 || got[0] != ".leading" || got[1] != ".." || got[2] != "\tx" {
+		t.Errorf("Unexpected unstuffing: %q", got)
+	}
+}
+
+func TestOverFullFields(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:full",
+		"X-Unknown:",
+		"From:",
+		":bytes",
+		"Xref:full")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"7\tSubject: Hello there\tmystery\tme@example.com\t1234\tXref: news.example.com misc.test:7")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cli.Over(7, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("Expected one overview, got %v", len(res))
+	}
+	o := res[0]
+	if o.Subject != "Hello there" {
+		t.Errorf("Expected full prefix stripped from subject, got %q", o.Subject)
+	}
+	if o.From != "me@example.com" || o.Bytes != 1234 {
+		t.Errorf("Fields after an unknown one misaligned: %#v", o)
+	}
+	if o.XRef != "news.example.com misc.test:7" {
+		t.Errorf("Expected full prefix stripped from xref, got %q", o.XRef)
+	}
+}
+
+func TestPostMany(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "<one@example.com> Article received OK")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 441, "Posting failed")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	stub.PrepareResponse("POST", 440, "Posting not permitted")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cli.PostMany([]io.Reader{
+		strings.NewReader("Subject: one\r\n\r\nbody\r\n"),
+		strings.NewReader("Message-ID: <two@example.com>\r\nSubject: two\r\n\r\nbody\r\n"),
+		strings.NewReader("Message-ID: <three@example.com>\r\nSubject: three\r\n\r\nbody\r\n"),
+		strings.NewReader("Message-ID: <four@example.com>\r\nSubject: four\r\n\r\nbody\r\n"),
+		strings.NewReader("Message-ID: <five@example.com>\r\nSubject: five\r\n\r\nbody\r\n"),
+	})
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Code != 440 {
+		t.Fatalf("Expected batch to stop on 440, got %v", err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("Expected 4 results, got %v", len(res))
+	}
+	want := []struct {
+		id   string
+		code int
+	}{
+		{"<one@example.com>", 0},
+		{"<two@example.com>", 441},
+		{"<three@example.com>", 0},
+		{"<four@example.com>", 440},
+	}
+	for i, w := range want {
+		if res[i].MessageID != w.id {
+			t.Errorf("Result %v: expected id %v, got %v", i, w.id, res[i].MessageID)
+		}
+		code := 0
+		if errors.As(res[i].Err, &perr) {
+			code = perr.Code
+		}
+		if code != w.code {
+			t.Errorf("Result %v: expected code %v, got %v", i, w.code, res[i].Err)
+		}
+	}
+	if len(stub.receivedArticles) != 3 {
+		t.Fatalf("Expected 3 articles sent, got %v", len(stub.receivedArticles))
+	}
+}
+
+func TestCommandReader(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list of newsgroups follows",
+		"misc.test 3002322 3000234 y",
+		"..dotted 2 1 n",
+		"comp.lang.go 1024 1 m")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := cli.CommandReader("LIST ACTIVE", 215)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "misc.test 3002322 3000234 y\n.dotted 2 1 n\ncomp.lang.go 1024 1 m\n"
+	if string(b) != want {
+		t.Fatalf("Expected %q, got %q", want, b)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partially read response is discarded on Close.
+	r, err = cli.CommandReader("LIST ACTIVE", 215)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := cli.Command("DATE", 111)
+	if err != nil || msg != "20190103185844" {
+		t.Fatalf("Expected DATE response after Close, got %q, %v", msg, err)
+	}
+}
+
+// blockingConn never returns from Read until closed, and has no
+// deadline support.
+type blockingConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newBlockingConn() *blockingConn {
+	r, w := io.Pipe()
+	return &blockingConn{r, w}
+}
+
+func (b *blockingConn) Read(p []byte) (int, error)  { return b.r.Read(p) }
+func (b *blockingConn) Write(p []byte) (int, error) { return len(p), nil }
+func (b *blockingConn) Close() error                { return b.w.Close() }
+
+func TestBannerTimeout(t *testing.T) {
+	cfg := Config{ConnectTimeout: 20 * time.Millisecond}
+
+	c, s := net.Pipe()
+	defer s.Close()
+	if _, err := NewConnWithConfig(c, cfg); err != ErrBannerTimeout {
+		t.Fatalf("Expected ErrBannerTimeout with deadline, got %v", err)
+	}
+
+	if _, err := NewConnWithConfig(newBlockingConn(), cfg); err != ErrBannerTimeout {
+		t.Fatalf("Expected ErrBannerTimeout without deadline, got %v", err)
+	}
+
+	// A prompt banner is unaffected.
+	cli, err := NewConnWithConfig(NewStub(200, "Stub"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.Banner != "Stub" {
+		t.Fatalf("Expected banner Stub, got %q", cli.Banner)
+	}
+}
+
+func TestGroupNoSuchGroup(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 411, "No such newsgroup")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Group("misc.missing")
+	if !errors.Is(err, ErrNoSuchGroup) {
+		t.Fatalf("Expected ErrNoSuchGroup, got %v", err)
+	}
+	var gerr *GroupError
+	if !errors.As(err, &gerr) || gerr.Group != "misc.missing" {
+		t.Fatalf("Expected error naming misc.missing, got %v", err)
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list of newsgroups follows")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := cli.List("ACTIVE nothing.matches.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups == nil || len(groups) != 0 {
+		t.Fatalf("Expected an empty list, got %#v", groups)
+	}
+}
+
+func TestArticleRaw(t *testing.T) {
+	article := "From: me@example.com\r\n" +
+		"Subject: signed\r\n" +
+		"\r\n" +
+		"-----BEGIN PGP SIGNED MESSAGE-----\r\n" +
+		"Trailing spaces   \r\n" +
+		".leading dot\r\n" +
+		"bare lf\n" +
+		"-----END PGP SIGNATURE-----\r\n"
+
+	stub := NewStub(200, "Stub")
+	stub.PrepareRawResponse("ARTICLE", 220, "1 <signed@example.com>",
+		strings.Replace(article, "\r\n.leading", "\r\n..leading", 1)+".\r\n")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := cli.ArticleRaw("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != article {
+		t.Fatalf("Article not preserved:\nwant %q\ngot  %q", article, got)
+	}
+
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatalf("Expected the connection to be usable, got %v", err)
+	}
+}
+
+func TestReadDotLinesRaw(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareRawResponse("HEAD", 221, "1 <a@example.com>",
+		"Subject: spaced out  \r\n"+
+			"X-Folded: one\r\n"+
+			" \ttwo\r\n"+
+			"..dot: stuffed\n"+
+			".\r\n")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = cli.Command("HEAD 1", 221); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = cli.readDotLinesRaw(func(line []byte) error {
+		got = append(got, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Subject: spaced out  \r\n", "X-Folded: one\r\n",
+		" \ttwo\r\n", ".dot: stuffed\n"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Line %v: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestGroupsWithDescriptions(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list of newsgroups follows",
+		"misc.test 3002322 3000234 y",
+		"misc.undescribed 10 1 n")
+	stub.PrepareDotPayloadResponse("LIST", 215, "descriptions follow",
+		"misc.test\tFor testing.  Really.",
+		"misc.gone      No longer carried")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := cli.GroupsWithDescriptions("misc.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %#v", groups)
+	}
+	want := []struct {
+		name, desc string
+		active     bool
+	}{
+		{"misc.test", "For testing.  Really.", true},
+		{"misc.undescribed", "", true},
+		{"misc.gone", "No longer carried", false},
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.Name != w.name || g.Description != w.desc || g.Active != w.active {
+			t.Errorf("Group %v: expected %+v, got %+v", i, w, g)
+		}
+	}
+	if groups[0].High != 3002322 {
+		t.Errorf("Expected active data for misc.test, got %+v", groups[0])
+	}
+	if stub.receivedLines[0] != "LIST ACTIVE misc.*" ||
+		stub.receivedLines[1] != "LIST NEWSGROUPS misc.*" {
+		t.Errorf("Unexpected commands: %v", stub.receivedLines)
+	}
+}
+
+func TestHeaderFields(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <a@x>",
+		"From: me@example.com",
+		"Newsgroups: misc.test",
+		"Subject: hello",
+		"Date: Thu, 03 Jan 2019 18:58:44 +0000",
+		"Path: news.example.com!not-for-mail")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := cli.HeaderFields("<a@x>", "subject", "From", "REFERENCES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Subject":    "hello",
+		"From":       "me@example.com",
+		"References": "",
+	}
+	if fmt.Sprint(h) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, h)
+	}
+	if n := CountReceivedRequests(stub, "HEAD"); n != 1 {
+		t.Errorf("Expected one HEAD, got %v", n)
+	}
+}
+
+func TestArticlePath(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <a@x>",
+		"Path: news.eternal-september.org!feeder.example.net!!"+
+			"news.uni-stuttgart.de.POSTED!not-for-mail",
+		"Subject: hops")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hops, err := cli.ArticlePath("<a@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "news.eternal-september.org|feeder.example.net|news.uni-stuttgart.de.POSTED"
+	if strings.Join(hops, "|") != want {
+		t.Errorf("Expected %q, got %q", want, hops)
+	}
+}
+
+func TestArticleNewsgroups(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <a@x>",
+		"From: me@example.com",
+		"Newsgroups: misc.test, alt.test,",
+		" comp.lang.go",
+		"Subject: crossposted")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <b@x>",
+		"Subject: no groups")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := cli.ArticleNewsgroups("<a@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(groups, "|") != "misc.test|alt.test|comp.lang.go" {
+		t.Errorf("Unexpected groups: %q", groups)
+	}
+
+	groups, err = cli.ArticleNewsgroups("<b@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups == nil || len(groups) != 0 {
+		t.Errorf("Expected an empty slice, got %#v", groups)
+	}
+}
+
+func TestArticleSplit(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("ARTICLE", 220, "1 <a@x>",
+		"Subject: split",
+		"From: me@example.com",
+		"",
+		"first line",
+		"..dotted line",
+		"",
+		"last line")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, body, err := cli.ArticleSplit("<a@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Get("Subject") != "split" || h.Get("From") != "me@example.com" {
+		t.Errorf("Unexpected headers: %v", h)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first line\n.dotted line\n\nlast line\n" {
+		t.Errorf("Unexpected body: %q", b)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArticlesMixed(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("ARTICLE", 220, "1 <a@x>",
+		"Subject: one", "", "first")
+	stub.PrepareResponse("ARTICLE", 430, "No such article")
+	stub.PrepareDotPayloadResponse("ARTICLE", 220, "3 <c@x>",
+		"Subject: three", "", "third")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, errs := cli.Articles([]string{"<a@x>", "<b@x>", "<c@x>"})
+	if len(rv) != 3 || len(errs) != 3 {
+		t.Fatalf("Expected 3 results, got %v and %v", len(rv), len(errs))
+	}
+	if errs[0] != nil || rv[0].Number != 1 || rv[0].Header.Get("Subject") != "one" ||
+		string(rv[0].Body) != "first\n" {
+		t.Errorf("Unexpected first article: %#v, %v", rv[0], errs[0])
+	}
+	var e *Error
+	if rv[1] != nil || !errors.As(errs[1], &e) || e.Code != 430 {
+		t.Errorf("Expected a 430 for the second article, got %#v, %v", rv[1], errs[1])
+	}
+	if errs[2] != nil || rv[2].MessageID != "<c@x>" || string(rv[2].Body) != "third\n" {
+		t.Errorf("Unexpected third article: %#v, %v", rv[2], errs[2])
+	}
+}
+
+func TestArticlesMalformedHeader(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("ARTICLE", 220, "1 <a@x>",
+		"Subject: one", "not a header", "", "first")
+	stub.PrepareDotPayloadResponse("ARTICLE", 220, "2 <b@x>",
+		"Subject: two", "", "second")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, errs := cli.Articles([]string{"<a@x>", "<b@x>"})
+	if errs[0] == nil || rv[0] == nil || !strings.Contains(string(rv[0].Body), "not a header") {
+		t.Errorf("Expected the raw first article with an error, got %#v, %v", rv[0], errs[0])
+	}
+	if errs[1] != nil || rv[1] == nil || rv[1].Header.Get("Subject") != "two" {
+		t.Errorf("Expected the second article to be fetched, got %#v, %v", rv[1], errs[1])
+	}
+}
+
+func TestBodyBounded(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("BODY", 222, "1 <a@example.com>",
+		"0123456789", "0123456789")
+	stub.PrepareDotPayloadResponse("BODY", 222, "2 <b@example.com>",
+		"0123456789")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := cli.BodyBounded("1", 15, &buf)
+	if err != ErrBodyTooLarge {
+		t.Fatalf("Expected ErrBodyTooLarge, got %v", err)
+	}
+	if n != 15 || buf.String() != "0123456789\n0123" {
+		t.Fatalf("Expected 15 bytes written, got %v (%q)", n, buf.String())
+	}
+
+	// The oversized body was drained; the next one is within bounds.
+	buf.Reset()
+	n, err = cli.BodyBounded("2", 11, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || buf.String() != "0123456789\n" {
+		t.Fatalf("Expected the whole body, got %v (%q)", n, buf.String())
+	}
+}
+
+func TestListKeyValue(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Distributions follow",
+		"usa\tLocal to the United States of America",
+		"fr     Local to France",
+		"bare")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Headers follow",
+		":",
+		":bytes",
+		"Subject:")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kvs, err := cli.ListKeyValue("DISTRIBUTIONS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"usa", "Local to the United States of America"},
+		{"fr", "Local to France"},
+		{"bare", ""},
+	}
+	if fmt.Sprint(kvs) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, kvs)
+	}
+
+	kvs, err = cli.ListKeyValue("HEADERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 3 || kvs[1][0] != ":bytes" || kvs[2][1] != "" {
+		t.Fatalf("Unexpected HEADERS pairs: %q", kvs)
+	}
+}
+
+func TestOverCommandUnavailable(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:")
+	stub.PrepareResponse("OVER", 502, "Permission denied")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Over(1, 10)
+	if !errors.Is(err, ErrCommandUnavailable) {
+		t.Fatalf("Expected ErrCommandUnavailable, got %v", err)
+	}
+	if !IsUnsupported(err) {
+		t.Fatalf("Expected %v to count as unsupported", err)
+	}
+	if IsUnsupported(&Error{430, "No such article"}) {
+		t.Fatal("430 should not count as unsupported")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("STAT", 223, "7 <a@example.com> exists")
+	stub.PrepareResponse("STAT", 430, "No such article")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", ":bytes", ":lines")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"7\tHello\t1234\t42")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, b, l, err := cli.Probe("<a@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || b != 1234 || l != 42 {
+		t.Fatalf("Expected exists with 1234 bytes/42 lines, got %v %v %v", exists, b, l)
+	}
+
+	exists, _, _, err = cli.Probe("<gone@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("Expected missing article not to exist")
+	}
+}
+
+func TestProbeHeadFallback(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("STAT", 223, "7 <a@example.com> exists")
+	stub.PrepareResponse("LIST", 503, "No overview")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "7 <a@example.com>",
+		"Subject: Hello", "Bytes: 999", "Lines: 12")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, b, l, err := cli.Probe("<a@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || b != 999 || l != 12 {
+		t.Fatalf("Expected exists with 999 bytes/12 lines, got %v %v %v", exists, b, l)
+	}
+}
+
+// overServer serves a fixed overview of n lines to each OVER on a
+// loopback TCP listener.
+func overServer(b *testing.B, n int) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var payload bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&payload, "%v\tSubject %v\tposter@example.com\tTue, 28 Nov 2017 20:09:05 GMT\t<%v@example.com>\t\t741002\t5695\r\n", i, i, i)
+	}
+	payload.WriteString(".\r\n")
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tp := textproto.NewConn(conn)
+				tp.PrintfLine("200 hello")
+				for {
+					line, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					switch strings.Fields(line)[0] {
+					case "LIST":
+						tp.PrintfLine("215 format")
+						tp.PrintfLine("Subject:\r\nFrom:\r\nDate:\r\nMessage-ID:\r\nReferences:\r\n:bytes\r\n:lines\r\n.")
+					case "OVER":
+						tp.PrintfLine("224 overview")
+						tp.W.Write(payload.Bytes())
+						tp.W.Flush()
+					}
+				}
+			}()
+		}
+	}()
+	b.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func benchmarkOverBuffer(b *testing.B, size int) {
+	addr := overServer(b, 10000)
+	cli, err := NewWithConfig("tcp", addr, Config{ReadBufferSize: size})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cli.Close()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err = cli.OverFields(0, 10000, OverHeaderMsgId); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOverDefaultBuffer(b *testing.B) {
+	benchmarkOverBuffer(b, 0)
+}
+
+func BenchmarkOverLargeBuffer(b *testing.B) {
+	benchmarkOverBuffer(b, 256*1024)
+}
+
+func TestOverNoGroupSelected(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:")
+	stub.PrepareResponse("OVER", 412, "No newsgroup selected")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Over(1, 10)
+	if !errors.Is(err, ErrNoGroupSelected) {
+		t.Fatalf("Expected ErrNoGroupSelected, got %v", err)
+	}
+}
+
+func TestOverReselectsGroup(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "10 1 10 misc.test")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:")
+	stub.PrepareResponse("OVER", 412, "No newsgroup selected")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:", "1\tHello\tme")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.Group("misc.test"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := cli.Over(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Subject != "Hello" {
+		t.Fatalf("Unexpected overview: %#v", res)
+	}
+	if n := CountReceivedRequests(stub, "GROUP"); n != 2 {
+		t.Fatalf("Expected the group to be re-selected, got %v GROUPs", n)
+	}
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("QUIT", 205, "Bye")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cli.Quit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.Close(); err != nil {
+		t.Fatalf("Expected a second close to succeed, got %v", err)
+	}
+	if _, _, err = cli.Command("DATE", 111); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Expected ErrClientClosed, got %v", err)
+	}
+	if _, err = cli.Group("misc.test"); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Expected ErrClientClosed from Group, got %v", err)
+	}
+	if CountReceivedRequests(stub, "QUIT") != 1 || len(stub.receivedRequests) != 1 {
+		t.Errorf("Unexpected requests: %q", stub.receivedRequests)
+	}
+}
+
+func TestGroupCreated(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Group creations:",
+		"misc.test 930445408 <creatme@isc.org>")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Group creations:")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, creator, err := cli.GroupCreated("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.Equal(time.Unix(930445408, 0)) || creator != "<creatme@isc.org>" {
+		t.Errorf("Got %v by %q", created, creator)
+	}
+	if stub.receivedLines[0] != "LIST ACTIVE.TIMES misc.test" {
+		t.Errorf("Unexpected command %q", stub.receivedLines[0])
+	}
+
+	_, _, err = cli.GroupCreated("misc.gone")
+	var gerr *GroupError
+	if !errors.Is(err, ErrNoSuchGroup) || !errors.As(err, &gerr) || gerr.Group != "misc.gone" {
+		t.Errorf("Expected a GroupError for misc.gone, got %v", err)
+	}
+}
+
+func TestCommandExpect(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 201, "Posting prohibited")
+	stub.PrepareResponse("XFOO", 500, "What?")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := cli.CommandExpect("MODE READER", 200, 201)
+	if err != nil || code != 201 {
+		t.Fatalf("Expected 201, got %v, %v", code, err)
+	}
+
+	code, msg, err := cli.CommandExpect("XFOO", 200, 201)
+	if !errors.Is(err, ErrUnknownCommand) || code != 500 || msg != "What?" {
+		t.Fatalf("Expected ErrUnknownCommand, got %v, %q, %v", code, msg, err)
+	}
+}
+
+func TestPostAndVerify(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "<new@example.com> Article received OK")
+	stub.PrepareResponse("STAT", 223, "0 <new@example.com>")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, ok, err := cli.PostAndVerify(strings.NewReader("From: me@example.com\n" +
+		"Newsgroups: misc.test\nSubject: hi\n\nbody\n"))
+	if err != nil || !ok || id != "<new@example.com>" {
+		t.Fatalf("Got %q, %v, %v", id, ok, err)
+	}
+	if stub.receivedLines[len(stub.receivedLines)-1] != "STAT <new@example.com>" {
+		t.Errorf("Unexpected requests: %q", stub.receivedLines)
+	}
+}
+
+func TestPostAndVerifyPending(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	stub.PrepareResponse("STAT", 430, "No such article")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, ok, err := cli.PostAndVerify(strings.NewReader("Message-ID: <mine@example.com>\n" +
+		"Newsgroups: misc.test\nSubject: hi\n\nbody\n"))
+	if err != ErrVerificationPending || ok || id != "<mine@example.com>" {
+		t.Fatalf("Got %q, %v, %v", id, ok, err)
+	}
+}
+
+func TestGroupHighWatermarks(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list follows",
+		"misc.test 3002322 3000234 y",
+		"misc.empty 0000000999 0000001000 n")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	highs, err := cli.GroupHighWatermarks("misc.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"misc.test": 3002322, "misc.empty": 999}
+	if fmt.Sprint(highs) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, highs)
+	}
+	if stub.receivedLines[0] != "LIST ACTIVE misc.*" {
+		t.Errorf("Unexpected command %q", stub.receivedLines[0])
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:")
+	for _, long := range []int{30, 10000} {
+		stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+			"1\tshort", "2\t"+strings.Repeat("x", long), "3\tshort")
+	}
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConnWithConfig(stub, Config{MaxLineBytes: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = cli.Over(1, 3); err != ErrLineTooLong {
+			t.Fatalf("Expected ErrLineTooLong, got %v", err)
+		}
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatalf("Expected the connection to stay in sync, got %v", err)
+	}
+}
+
+func TestMaxLineBytesList(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Newsgroups follow",
+		"misc.test 2 1 y", strings.Repeat("x", 100)+" 2 1 y")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConnWithConfig(stub, Config{MaxLineBytes: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.List("ACTIVE"); err != ErrLineTooLong {
+		t.Fatalf("Expected ErrLineTooLong, got %v", err)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatalf("Expected the connection to stay in sync, got %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER", "OVER", "LIST ACTIVE NEWSGROUPS OVERVIEW.FMT")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cli.Require("OVER", "list overview.fmt"); err != nil {
+		t.Fatal(err)
+	}
+	err = cli.Require("OVER", "COMPRESS", "LIST HEADERS")
+	var cerr *CapabilityError
+	if !errors.Is(err, ErrMissingCapability) || !errors.As(err, &cerr) {
+		t.Fatalf("Expected a CapabilityError, got %v", err)
+	}
+	if strings.Join(cerr.Missing, ",") != "COMPRESS,LIST HEADERS" {
+		t.Errorf("Unexpected missing capabilities: %q", cerr.Missing)
+	}
+	if n := CountReceivedRequests(stub, "CAPABILITIES"); n != 1 {
+		t.Errorf("Expected capabilities to be fetched once, got %v", n)
+	}
+}
+
+func TestPostWriter(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "<gen@example.com> Article received OK")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, finish, err := cli.PostWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"Newsgroups: misc.test\r\n", "Subject: chunks\r\n\r\n",
+		".starts with a dot\r\n", "no newline at the end"} {
+		if _, err = io.WriteString(w, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		id, err := finish()
+		if err != nil || id != "<gen@example.com>" {
+			t.Fatalf("Got %q, %v", id, err)
+		}
+	}
+
+	want := "Newsgroups: misc.test\r\nSubject: chunks\r\n\r\n" +
+		"..starts with a dot\r\nno newline at the end\r\n"
+	if len(stub.receivedArticles) != 1 || stub.receivedArticles[0] != want {
+		t.Errorf("Expected %q, got %q", want, stub.receivedArticles)
+	}
+}
+
+func TestOverEmptyRange(t *testing.T) {
+	for _, code := range []int{420, 423} {
+		stub := NewStub(200, "Stub")
+		stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+			"Subject:")
+		stub.PrepareResponse("OVER", code, "No articles")
+		stub.PrepareResponse("XOVER", code, "No articles")
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := cli.Over(5, 10)
+		if err != nil || len(v) != 0 {
+			t.Errorf("%v: expected no articles and no error, got %v, %v", code, v, err)
+		}
+		v, err = cli.XOver(5, 10)
+		if err != nil || len(v) != 0 {
+			t.Errorf("%v: expected no articles from XOVER, got %v, %v", code, v, err)
+		}
+	}
+
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:")
+	stub.PrepareResponse("OVER", 503, "Overview unavailable")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Over(5, 10); err == nil {
+		t.Error("Expected an error for 503")
+	}
+}
+
+func TestAutoReauth(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("authinfo", 381, "Password required")
+	stub.PrepareResponse("authinfo", 281, "Authentication accepted")
+	stub.PrepareResponse("authinfo", 381, "Password required")
+	stub.PrepareResponse("authinfo", 281, "Authentication accepted")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER")
+	stub.PrepareResponse("GROUP", 480, "Session expired")
+	stub.PrepareResponse("GROUP", 211, "3 1 3 misc.test")
+	cli, err := NewConnWithConfig(stub, Config{AutoReauth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Authenticate("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := cli.Group("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.High != 3 {
+		t.Errorf("Unexpected group: %#v", g)
+	}
+	if n := CountReceivedRequests(stub, "authinfo"); n != 4 {
+		t.Errorf("Expected to authenticate again, got %v authinfo commands", n)
+	}
+}
+
+func TestAutoReauthBodyAndPost(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	for i := 0; i < 3; i++ {
+		stub.PrepareResponse("authinfo", 381, "Password required")
+		stub.PrepareResponse("authinfo", 281, "Authentication accepted")
+	}
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "READER")
+	stub.PrepareResponse("BODY", 480, "Session expired")
+	stub.PrepareDotPayloadResponse("BODY", 222, "1 <a@x>", "hello")
+	stub.PrepareResponse("POST", 480, "Session expired")
+	stub.PrepareResponse("POST", 340, "Send article")
+	stub.PrepareResponse("POST", 240, "Article received OK")
+	cli, err := NewConnWithConfig(stub, Config{AutoReauth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Authenticate("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, r, err := cli.Body("<a@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "hello\n" {
+		t.Errorf("Unexpected body %q", data)
+	}
+	if err = cli.Post(strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "authinfo"); n != 6 {
+		t.Errorf("Expected to authenticate again twice, got %v authinfo commands", n)
+	}
+}
+
+func TestBodyAuthRequiredNamesCommand(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("BODY", 480, "Authentication required")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = cli.Body("<a@x>")
+	var cerr *CommandError
+	if !errors.Is(err, ErrAuthRequired) || !errors.As(err, &cerr) || cerr.Command != "BODY <a@x>" {
+		t.Fatalf("Expected a CommandError for BODY, got %v", err)
+	}
+}
+
+func TestAuthRequiredWithoutReauth(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 480, "Authentication required")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.Group("misc.test")
+	var cerr *CommandError
+	if !errors.Is(err, ErrAuthRequired) || !errors.As(err, &cerr) {
+		t.Fatalf("Expected a CommandError for 480, got %v", err)
+	}
+	if cerr.Command != "GROUP misc.test" {
+		t.Errorf("Expected the command to be recorded, got %q", cerr.Command)
+	}
+}
+
+func TestCanPost(t *testing.T) {
+	tests := []struct {
+		banner int
+		caps   []string
+		group  string
+		want   bool
+	}{
+		{201, []string{"VERSION 2", "POST"}, "", false},
+		{200, []string{"VERSION 2", "READER"}, "", false},
+		{200, []string{"VERSION 2", "POST"}, "", true},
+		{200, []string{"VERSION 2", "POST"}, "misc.test 10 1 n", false},
+		{200, []string{"VERSION 2", "POST"}, "misc.test 10 1 m", true},
+		{200, []string{"VERSION 2", "POST"}, "misc.test 10 1 y", true},
+	}
+	for i, test := range tests {
+		stub := NewStub(test.banner, "Stub")
+		stub.PrepareDotPayloadResponseArray("CAPABILITIES", 101, "Capability list:", test.caps)
+		stub.PrepareResponse("GROUP", 211, "10 1 10 misc.test")
+		stub.PrepareDotPayloadResponse("LIST", 215, "list follows", test.group)
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.group != "" {
+			if _, err = cli.Group("misc.test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ok, err := cli.CanPost()
+		if err != nil {
+			t.Errorf("%v: %v", i, err)
+		}
+		if ok != test.want {
+			t.Errorf("%v: expected %v, got %v", i, test.want, ok)
+		}
+	}
+}
+
+func TestCanPostListActiveRefused(t *testing.T) {
+	tests := []struct {
+		code    int
+		want    bool
+		wantErr bool
+	}{
+		{480, false, true},
+		{502, false, true},
+		{501, true, false},
+		{503, true, false},
+	}
+	for _, test := range tests {
+		stub := NewStub(200, "Stub")
+		stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:", "VERSION 2", "POST")
+		stub.PrepareResponse("GROUP", 211, "10 1 10 misc.test")
+		stub.PrepareResponse("LIST", test.code, "No")
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cli.Group("misc.test"); err != nil {
+			t.Fatal(err)
+		}
+		ok, err := cli.CanPost()
+		if ok != test.want || (err != nil) != test.wantErr {
+			t.Errorf("%v: expected %v (error %v), got %v, %v", test.code, test.want, test.wantErr, ok, err)
+		}
+	}
+}
+
+func TestOverviewCleanAccessors(t *testing.T) {
+	// The format doesn't say full, but the server prefixes anyway.
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:", "Xref:")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"1\tSubject: hello\tFROM: me@example.com\tXref: host misc.test:1",
+		"2\tsubject matter\tme@example.com\thost misc.test:2")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := cli.Over(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0].SubjectClean() != "hello" || v[0].FromClean() != "me@example.com" ||
+		v[0].XRefClean() != "host misc.test:1" {
+		t.Errorf("Expected prefixes stripped, got %q %q %q",
+			v[0].SubjectClean(), v[0].FromClean(), v[0].XRefClean())
+	}
+	if v[1].SubjectClean() != "subject matter" || v[1].FromClean() != "me@example.com" {
+		t.Errorf("Expected plain values unchanged, got %q %q",
+			v[1].SubjectClean(), v[1].FromClean())
+	}
+}
+
+func TestOverMixedLineEndings(t *testing.T) {
+	// The limited line reader strips line endings itself.
+	for _, cfg := range []Config{{}, {MaxLineBytes: 1000}} {
+		testOverMixedLineEndings(t, cfg)
+	}
+}
+
+func testOverMixedLineEndings(t *testing.T, cfg Config) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:")
+	stub.PrepareRawResponse("OVER", 224, "Overview follows",
+		"1\ttrailing spaces  \tme@example.com\n"+
+			"2\t  leading spaces\tyou@example.com\r\n"+
+			".\n")
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConnWithConfig(stub, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := cli.Over(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 || v[0].Subject != "trailing spaces  " || v[1].Subject != "  leading spaces" {
+		t.Fatalf("Expected whitespace to be kept, got %#v", v)
+	}
+	if v[0].From != "me@example.com" || v[1].From != "you@example.com" {
+		t.Errorf("Expected line endings stripped, got %q and %q", v[0].From, v[1].From)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputePollWindow(t *testing.T) {
+	last := time.Date(2019, 1, 3, 18, 0, 0, 0, time.UTC)
+	now := last.Add(10 * time.Minute)
+	if got := ComputePollWindow(last, 2*time.Minute, now); !got.Equal(last.Add(-2 * time.Minute)) {
+		t.Errorf("Expected two minutes before the last poll, got %v", got)
+	}
+	// A last poll in the future (clock trouble) is clamped to now.
+	if got := ComputePollWindow(now.Add(time.Hour), time.Minute, now); !got.Equal(now) {
+		t.Errorf("Expected now, got %v", got)
+	}
+}
+
+func TestNewNews(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("NEWNEWS", 230, "list of new articles follows",
+		"<a@x>", "<b@x>")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zone := time.FixedZone("", 2*60*60)
+	last := time.Date(2019, 1, 3, 20, 5, 0, 0, zone)
+	ids, err := cli.NewNews("misc.*", ComputePollWindow(last, 5*time.Minute, last))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "<a@x>,<b@x>" {
+		t.Errorf("Unexpected ids: %q", ids)
+	}
+	if stub.receivedLines[0] != "NEWNEWS misc.* 20190103 180000 GMT" {
+		t.Errorf("Unexpected command %q", stub.receivedLines[0])
+	}
+}
+
+// writeCounter counts the writes reaching the connection.
+type writeCounter struct {
+	*stubReaderWriter
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.stubReaderWriter.Write(p)
+}
+
+func TestStatManyPipelined(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	for i := 1; i <= 10; i++ {
+		if i == 4 {
+			stub.PrepareResponse("STAT", 423, "No article with that number")
+			continue
+		}
+		stub.PrepareResponse("STAT", 223, fmt.Sprintf("%d <%d@x>", i, i))
+	}
+	wc := &writeCounter{stubReaderWriter: stub}
+	cli, err := NewConn(wc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var specs []string
+	for i := 1; i <= 10; i++ {
+		specs = append(specs, fmt.Sprint(i))
+	}
+	wc.writes = 0
+	rv, errs := cli.StatMany(specs)
+	for i := range specs {
+		if i == 3 {
+			if !isNoArticle(errs[i]) {
+				t.Errorf("Expected a missing article 4, got %v", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil || rv[i] != int64(i+1) {
+			t.Errorf("Article %v: got %v, %v", i+1, rv[i], errs[i])
+		}
+	}
+	if wc.writes != 1 {
+		t.Errorf("Expected the STATs in one write, got %v", wc.writes)
+	}
+	if n := CountReceivedRequests(stub, "STAT"); n != 10 {
+		t.Errorf("Expected 10 STATs, got %v", n)
+	}
+
+	// Ordinary commands still go out straight away.
+	wc.writes = 0
+	if _, _, err = cli.Stat("10"); err != nil {
+		t.Fatal(err)
+	}
+	if wc.writes != 1 {
+		t.Errorf("Expected one write for Stat, got %v", wc.writes)
+	}
+}
+
+func TestPostingLimits(t *testing.T) {
+	tests := []struct {
+		caps []string
+		max  int64
+		ok   bool
+	}{
+		{[]string{"VERSION 2", "POST", "MAXARTSIZE 1048576"}, 1048576, true},
+		{[]string{"VERSION 2", "POST MAXARTSIZE=65536"}, 65536, true},
+		{[]string{"VERSION 2", "POST"}, 0, false},
+	}
+	for _, test := range tests {
+		stub := NewStub(200, "Stub")
+		stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:", test.caps...)
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		max, ok, err := cli.PostingLimits()
+		if err != nil || max != test.max || ok != test.ok {
+			t.Errorf("%q: got %v, %v, %v", test.caps, max, ok, err)
+		}
+	}
+
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("CAPABILITIES", 500, "What?")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := cli.PostingLimits(); ok || err != nil {
+		t.Errorf("Expected no limit without CAPABILITIES, got %v, %v", ok, err)
+	}
+}
+
+func TestSplitXRefHost(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		stub := overBenchStub(1)
+		cli, err := NewConnWithConfig(stub, Config{SplitXRefHost: split})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv, err := cli.Over(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const refs = "alt.binaries.multimedia.anime.highspeed:382401874"
+		host, xref := rv[0].XRefHost, rv[0].XRefClean()
+		if split && (host != "news.usenetserver.com" || xref != refs) {
+			t.Errorf("Expected the host split from the refs, got %q and %q", host, xref)
+		}
+		if !split && (host != "" || xref != "news.usenetserver.com "+refs) {
+			t.Errorf("Expected the Xref unchanged, got %q and %q", host, xref)
+		}
+	}
+}
+
+func TestOverviewFormatRaw(t *testing.T) {
+	stub := overBenchStub(1)
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := cli.OverviewFormatRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Subject:|From:|Date:|Message-ID:|References:|:bytes|:lines|Xref:full"
+	if strings.Join(lines, "|") != want {
+		t.Errorf("Unexpected format lines %q", lines)
+	}
+
+	// Each call asks the server again.
+	if _, err = cli.OverviewFormatRaw(); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "LIST"); n != 2 {
+		t.Errorf("Expected 2 LISTs, got %v", n)
+	}
+}
+
+func TestArticlesSinceMsgID(t *testing.T) {
+	stub := overBenchStub(1)
+	stub.PrepareResponse("GROUP", 211, "100 1 100 misc.test")
+	stub.PrepareResponse("STAT", 223, "42 <last@x>")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.ArticlesSinceMsgID("misc.test", "<last@x>"); err != nil {
+		t.Fatal(err)
+	}
+	if !HasReceivedLine(stub, "OVER 43-") {
+		t.Errorf("Expected OVER 43-, got %q", stub.receivedLines)
+	}
+}
+
+func TestArticlesSinceMsgIDXref(t *testing.T) {
+	stub := overBenchStub(1)
+	stub.PrepareResponse("GROUP", 211, "100 1 100 misc.test")
+	stub.PrepareResponse("STAT", 223, "0 <last@x>")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <last@x>",
+		"Message-Id: <last@x>", "Xref: news.example.com alt.test:7 misc.test:50")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.ArticlesSinceMsgID("misc.test", "<last@x>"); err != nil {
+		t.Fatal(err)
+	}
+	if !HasReceivedLine(stub, "OVER 51-") {
+		t.Errorf("Expected OVER 51-, got %q", stub.receivedLines)
+	}
+}
+
+func TestArticlesSinceMsgIDMissing(t *testing.T) {
+	stub := overBenchStub(1)
+	stub.PrepareResponse("GROUP", 211, "100 5 100 misc.test")
+	stub.PrepareResponse("STAT", 430, "No such article")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.ArticlesSinceMsgID("misc.test", "<gone@x>"); err != nil {
+		t.Fatal(err)
+	}
+	if !HasReceivedLine(stub, "OVER 5-") {
+		t.Errorf("Expected OVER 5-, got %q", stub.receivedLines)
+	}
+}
+
+func TestBadBanner(t *testing.T) {
+	for _, banner := range []string{"HTTP/1.1 400 Bad Request", "OK"} {
+		stub := NewStub(200, "Stub")
+		stub.out.Reset()
+		stub.out.WriteString(banner + "\r\n")
+		_, err := NewConn(stub)
+		if !errors.Is(err, ErrBadBanner) {
+			t.Errorf("%q: expected ErrBadBanner, got %v", banner, err)
+			continue
+		}
+		var be *BannerError
+		if !errors.As(err, &be) || be.Line != banner {
+			t.Errorf("Expected the raw banner %q, got %v", banner, err)
+		}
+		var pe textproto.ProtocolError
+		if !errors.As(err, &pe) {
+			t.Errorf("Expected the underlying error to be kept, got %v", err)
+		}
+	}
+
+	// A well formed refusal is still a response error.
+	_, err := NewConn(NewStub(502, "Service unavailable"))
+	if errors.Is(err, ErrBadBanner) || !errors.As(err, new(*Error)) {
+		t.Errorf("Expected an *Error for a 502 banner, got %v", err)
+	}
+}
+
+func TestHdrMulti(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HDR", 225, "Headers follow",
+		"1 First post", "2 Re: First post", "3 ")
+	stub.PrepareDotPayloadResponse("HDR", 225, "Headers follow",
+		"1 a@example.com", "3 c@example.com")
+	stub.PrepareResponse("HDR", 502, "Not available for that header")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, err := cli.HdrMulti([]string{"subject", "From", "X-Private"}, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]map[string]string{
+		1: {"Subject": "First post", "From": "a@example.com"},
+		2: {"Subject": "Re: First post"},
+		3: {"From": "c@example.com"},
+	}
+	if !reflect.DeepEqual(rv, want) {
+		t.Errorf("Expected %v, got %v", want, rv)
+	}
+	lines := "HDR subject 1-3|HDR From 1-3|HDR X-Private 1-3"
+	if strings.Join(stub.receivedLines, "|") != lines {
+		t.Errorf("Unexpected commands %q", stub.receivedLines)
+	}
+}
+
+func TestOverStreamPartial(t *testing.T) {
+	stub := overviewStub()
+	lines := []string{
+		"1\tone\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1\tXref: h misc.test:1",
+		"2\ttwo\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1\tXref: h misc.test:2",
+	}
+	// The connection drops before the terminating dot.
+	stub.PrepareRawResponse("OVER", 224, "Overview:", strings.Join(lines, "\r\n")+"\r\n")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint64
+	err = cli.OverStream(Range{1, 3}, func(o *nntp.ArticleOverview) error {
+		got = append(got, o.Id)
+		return nil
+	})
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a PartialError, got %v", err)
+	}
+	if pe.LastNumber != 2 || len(got) != 2 {
+		t.Errorf("Expected to stop after article 2, got %v (saw %v)", pe.LastNumber, got)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected the underlying error, got %v", err)
+	}
+}
+
+func TestOverStreamCallbackError(t *testing.T) {
+	stub := overBenchStub(3)
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	err = cli.OverStream(Range{0, 2}, func(o *nntp.ArticleOverview) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+}
+
+func TestOverviewStats(t *testing.T) {
+	stub := overviewStub()
+	stub.PrepareResponse("GROUP", 211, "10 1 12 misc.test")
+	stub.PrepareResponse("OVER", 423, "No articles in that range")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"12\ttwelve\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<12@x>\t\t10\t1\tXref: h misc.test:12")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, low, high, err := cli.OverviewStats("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 || low || !high {
+		t.Errorf("Expected 10, false, true; got %v, %v, %v", count, low, high)
+	}
+	if !HasReceivedLine(stub, "OVER 1") || !HasReceivedLine(stub, "OVER 12") {
+		t.Errorf("Expected only the endpoints to be requested, got %q", stub.receivedLines)
+	}
+}
+
+func TestOverLineFieldCounts(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "List Format:", "Subject:",
+		"From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines",
+		"Xref:full", "Newsgroups:full")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		// Trailing empty fields left off.
+		"1\tshort\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>",
+		// All fields, plus one the format doesn't name.
+		"2\tlong\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1\tXref: h misc.test:2\tNewsgroups: misc.test,alt.test\textra")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := cli.Over(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 2 {
+		t.Fatalf("Expected 2 articles, got %v", len(rv))
+	}
+	if rv[0].MessageId != "<1@x>" || rv[0].Bytes != 0 || rv[0].XRef != "" || rv[0].Extra != nil {
+		t.Errorf("Unexpected short line result %#v", rv[0])
+	}
+	if rv[1].Lines != 1 || rv[1].XRefClean() != "h misc.test:2" {
+		t.Errorf("Unexpected long line result %#v", rv[1])
+	}
+	if len(rv[1].Extra) != 1 || rv[1].Extra["Newsgroups"] != "misc.test,alt.test" {
+		t.Errorf("Expected Newsgroups in Extra, got %q", rv[1].Extra)
+	}
+}
+
+func TestGroupBounds(t *testing.T) {
+	stub := overviewStub()
+	stub.PrepareResponse("GROUP", 211, "10 3 12 misc.test")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"3\tthree\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<3@x>\t\t10\t1\tXref: h misc.test:3")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"12\ttwelve\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<12@x>\t\t10\t1\tXref: h misc.test:12")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last, err := cli.GroupBounds("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == nil || first.Id != 3 || last == nil || last.Id != 12 {
+		t.Errorf("Expected articles 3 and 12, got %v and %v", first, last)
+	}
+}
+
+func TestGroupBoundsEmpty(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "0 13 12 misc.test")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last, err := cli.GroupBounds("misc.test")
+	if err != nil || first != nil || last != nil {
+		t.Errorf("Expected nothing for an empty group, got %v, %v, %v", first, last, err)
+	}
+	if HasReceivedRequest(stub, "OVER") {
+		t.Error("Expected no OVER for an empty group")
+	}
+}
+
+func TestListCounts(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "list of newsgroups follows",
+		"misc.test 3002322 3000234 1988 y",
+		"comp.risks 442001 441099 902 m")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := cli.ListCounts("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []nntp.Group{
+		{Name: "misc.test", High: 3002322, Low: 3000234, Count: 1988, Posting: nntp.PostingPermitted},
+		{Name: "comp.risks", High: 442001, Low: 441099, Count: 902, Posting: nntp.PostingModerated},
+	}
+	if !reflect.DeepEqual(rv, want) {
+		t.Errorf("Expected %v, got %v", want, rv)
+	}
+	if stub.receivedLines[0] != "LIST COUNTS *" {
+		t.Errorf("Unexpected command %q", stub.receivedLines[0])
+	}
+}
+
+func TestListCountsUnsupported(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("LIST", 503, "Unsupported LIST keyword")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.ListCounts("*"); !errors.Is(err, ErrMissingCapability) {
+		t.Errorf("Expected ErrMissingCapability, got %v", err)
+	}
+}
+
+func TestPostManyDuplicateMessageID(t *testing.T) {
+	batch := func() []io.Reader {
+		return []io.Reader{
+			strings.NewReader("Message-ID: <one@example.com>\r\nSubject: one\r\n\r\nbody\r\n"),
+			strings.NewReader("Message-ID: <two@example.com>\r\nSubject: two\r\n\r\nbody\r\n"),
+			strings.NewReader("Message-ID: <one@example.com>\r\nSubject: again\r\n\r\nbody\r\n"),
+		}
+	}
+	for _, detect := range []bool{false, true} {
+		stub := NewStub(200, "Stub")
+		for i := 0; i < 3; i++ {
+			stub.PrepareResponse("POST", 340, "Send article")
+			stub.PrepareResponse("POST", 240, "Article received OK")
+		}
+		cli, err := NewConnWithConfig(stub, Config{DetectDuplicateIDs: detect})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := cli.PostMany(batch())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var de *DuplicateMessageIDError
+		dup := errors.As(res[2].Err, &de)
+		if dup != detect || (dup && de.MessageID != "<one@example.com>") {
+			t.Errorf("Detect %v: unexpected result %v", detect, res[2].Err)
+		}
+		want := 3
+		if detect {
+			want = 2
+		}
+		if len(stub.receivedArticles) != want {
+			t.Errorf("Detect %v: expected %v articles sent, got %v", detect, want, len(stub.receivedArticles))
+		}
+	}
+}
+
+func TestCapabilitiesFresh(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "STARTTLS", "AUTHINFO")
+	stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+		"VERSION 2", "AUTHINFO USER", "OVER")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.CapabilitiesFresh(); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := cli.CapabilitiesFresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := CountReceivedRequests(stub, "CAPABILITIES"); n != 2 {
+		t.Errorf("Expected 2 CAPABILITIES, got %v", n)
+	}
+	// The cache holds the latest list.
+	cached, err := cli.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(caps, "|") != "VERSION 2|AUTHINFO USER|OVER" ||
+		strings.Join(cached, "|") != strings.Join(caps, "|") {
+		t.Errorf("Unexpected capabilities %q, cached %q", caps, cached)
+	}
+	if n := CountReceivedRequests(stub, "CAPABILITIES"); n != 2 {
+		t.Errorf("Expected the cached list to be used, got %v requests", n)
+	}
+}
+
+func TestGroupResponseVariants(t *testing.T) {
+	for _, msg := range []string{
+		"1234 1 1234 misc.test group selected",
+		"1234  1  1234 misc.test",
+		"00001234 0000000001 0000001234 misc.test",
+	} {
+		stub := NewStub(200, "Stub")
+		stub.PrepareResponse("GROUP", 211, msg)
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := cli.Group("misc.test")
+		if err != nil {
+			t.Errorf("%q: %v", msg, err)
+			continue
+		}
+		if g.Count != 1234 || g.Low != 1 || g.High != 1234 || g.Name != "misc.test" {
+			t.Errorf("%q: unexpected group %#v", msg, g)
+		}
+	}
+}
+
+func TestPostTrailingNewline(t *testing.T) {
+	for _, article := range []string{
+		"Subject: x\r\n\r\nlast line",
+		"Subject: x\r\n\r\nlast line\r\n",
+		"Subject: x\n\nlast line\n",
+	} {
+		stub := NewStub(200, "Stub")
+		stub.PrepareResponse("POST", 340, "Send article")
+		stub.PrepareResponse("POST", 240, "Article received OK")
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cli.Post(strings.NewReader(article)); err != nil {
+			t.Fatalf("%q: %v", article, err)
+		}
+		want := "Subject: x\r\n\r\nlast line\r\n"
+		if len(stub.receivedArticles) != 1 || stub.receivedArticles[0] != want {
+			t.Errorf("%q: expected %q on the wire, got %q", article, want, stub.receivedArticles)
+		}
+	}
+}
+
+func TestOverHugeArticleNumbers(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "List Format:", "Subject:",
+		"From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"9223372036854775807\tlast\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<max@x>\t\t10\t1",
+		"9223372036854775808\ttoo far\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<over@x>\t\t10\t1")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, bad, err := cli.OverCollect(math.MaxInt64-1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 1 || OverviewSet(rv).Numbers()[0] != math.MaxInt64 {
+		t.Errorf("Expected the largest int64 number to be kept, got %v", rv)
+	}
+	if len(bad) != 1 || bad[0].Err != ErrArticleNumberRange {
+		t.Errorf("Expected ErrArticleNumberRange for the next number, got %v", bad)
+	}
+	if !HasReceivedLine(stub, "OVER 9223372036854775806-") {
+		t.Errorf("Unexpected commands %q", stub.receivedLines)
+	}
+}
+
+func TestDrainArticle(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponseArray("BODY", 222, "0 <a@x>", lines)
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing to drain yet.
+	if err = cli.DrainArticle(); err != nil {
+		t.Fatal(err)
+	}
+	_, _, r, err := cli.Body("<a@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.DrainArticle(); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := cli.Command("DATE", 111); err != nil || msg != "20190103185844" {
+		t.Fatalf("Expected DATE after draining, got %q, %v", msg, err)
+	}
+	if err = cli.DrainArticle(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffActive(t *testing.T) {
+	old := []nntp.Group{
+		{Name: "misc.test", High: 20, Low: 10, Posting: nntp.PostingPermitted},
+		{Name: "alt.gone", High: 5, Low: 1},
+		{Name: "comp.risks", High: 100, Low: 1},
+		{Name: "alt.quiet", High: 7, Low: 3},
+	}
+	new := []nntp.Group{
+		{Name: "misc.test", High: 25, Low: 10, Posting: nntp.PostingPermitted},
+		{Name: "alt.quiet", High: 7, Low: 3, Posting: nntp.PostingModerated},
+		{Name: "alt.new", High: 1, Low: 1},
+		{Name: "comp.risks", High: 100, Low: 50},
+	}
+	added, removed, changed := DiffActive(old, new)
+	names := func(gs []nntp.Group) string {
+		var rv []string
+		for _, g := range gs {
+			rv = append(rv, g.Name)
+		}
+		return strings.Join(rv, ",")
+	}
+	if got := names(added); got != "alt.new" {
+		t.Errorf("Unexpected added groups %q", got)
+	}
+	if got := names(removed); got != "alt.gone" {
+		t.Errorf("Unexpected removed groups %q", got)
+	}
+	if got := names(changed); got != "misc.test,comp.risks" {
+		t.Errorf("Unexpected changed groups %q", got)
+	}
+	if changed[0].High != 25 {
+		t.Errorf("Expected the new watermarks, got %v", changed[0])
+	}
+
+	if a, r, c := DiffActive(new, new); a != nil || r != nil || c != nil {
+		t.Errorf("Expected no differences, got %v %v %v", a, r, c)
+	}
+}
+
+func TestArticleSize(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HDR", 225, "Headers follow", "0 741002")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := cli.ArticleSize("<a@x>")
+	if err != nil || n != 741002 {
+		t.Errorf("Expected 741002, got %v, %v", n, err)
+	}
+	if stub.receivedLines[0] != "HDR :bytes <a@x>" || HasReceivedRequest(stub, "HEAD") {
+		t.Errorf("Unexpected commands %q", stub.receivedLines)
+	}
+}
+
+func TestArticleSizeHeadFallback(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("HDR", 500, "What?")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <a@x>",
+		"Message-Id: <a@x>", "Bytes: 1234")
+	stub.PrepareDotPayloadResponse("HEAD", 221, "0 <b@x>", "Message-Id: <b@x>")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := cli.ArticleSize("<a@x>")
+	if err != nil || n != 1234 {
+		t.Errorf("Expected 1234 from HEAD, got %v, %v", n, err)
+	}
+	if _, err = cli.ArticleSize("<b@x>"); err != ErrSizeUnavailable {
+		t.Errorf("Expected ErrSizeUnavailable, got %v", err)
+	}
+}
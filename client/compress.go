@@ -0,0 +1,66 @@
+package nntpclient
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+// ErrCompressionActive is returned when asking to compress a
+// connection that already is.
+var ErrCompressionActive = errors.New("compression already active")
+
+// flateWriter compresses writes, flushing after each one so every
+// command reaches the server immediately.
+type flateWriter struct {
+	w *flate.Writer
+}
+
+func (f flateWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.w.Flush()
+	}
+	return n, err
+}
+
+// compressedConn is the connection once COMPRESS DEFLATE is active.
+type compressedConn struct {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// Compress enables RFC 8054 COMPRESS DEFLATE.
+//
+// Unlike per-response compression, this compresses all traffic in both
+// directions for the rest of the session.  The server must advertise
+// DEFLATE in its COMPRESS capability; ErrCompressionNotSupported is
+// returned otherwise.  If TLS is used, STARTTLS (if any) must be done
+// first.
+func (c *Client) Compress() error {
+	if c.compressed {
+		return ErrCompressionActive
+	}
+	if err := c.supportsCompression("DEFLATE"); err != nil {
+		return err
+	}
+	_, _, err := c.Command("COMPRESS DEFLATE", 206)
+	if err != nil {
+		return err
+	}
+
+	fw, err := flate.NewWriter(c.rwc, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	// The compressed stream starts right after the 206 line, and may
+	// already be buffered in the old reader.
+	c.conn = newTextprotoConn(compressedConn{
+		Reader: flate.NewReader(c.conn.R),
+		Writer: flateWriter{fw},
+		Closer: c.rwc,
+	}, c.config)
+	c.compressed = true
+	return nil
+}
@@ -0,0 +1,224 @@
+package nntpclient
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+// compressServer runs a minimal server on a pipe that negotiates
+// COMPRESS DEFLATE and then answers commands over the compressed
+// stream.  Each received command is sent on the returned channel.
+func compressServer(caps string) (net.Conn, chan string) {
+	cconn, sconn := net.Pipe()
+	got := make(chan string, 10)
+	go func() {
+		defer sconn.Close()
+		defer close(got)
+		tp := textproto.NewConn(sconn)
+		tp.PrintfLine("200 hello")
+		var fw *flate.Writer
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			got <- line
+			switch line {
+			case "CAPABILITIES":
+				tp.PrintfLine("101 Capability list:")
+				dw := tp.DotWriter()
+				io.WriteString(dw, "VERSION 2\n"+caps+"\n")
+				dw.Close()
+			case "COMPRESS DEFLATE":
+				tp.PrintfLine("206 Compression active")
+				fw, _ = flate.NewWriter(sconn, flate.BestSpeed)
+				tp = textproto.NewConn(compressedConn{
+					Reader: flate.NewReader(tp.R),
+					Writer: flateWriter{fw},
+					Closer: sconn,
+				})
+			case "LISTGROUP misc.test":
+				// Truncated: the stream ends cleanly but without
+				// the terminating dot.
+				tp.PrintfLine("211 3 1 3 misc.test")
+				tp.PrintfLine("1")
+				tp.PrintfLine("2")
+				fw.Close()
+				return
+			case "DATE":
+				tp.PrintfLine("111 20190103185844")
+			case "BODY <b@x>":
+				tp.PrintfLine("222 0 <b@x> body follows")
+				dw := tp.DotWriter()
+				io.WriteString(dw, "plain text\n.leading dot\n")
+				dw.Close()
+			case "BODY <empty@x>":
+				tp.PrintfLine("222 0 <empty@x> body follows")
+				tp.PrintfLine(".")
+			case "LIST ACTIVE":
+				tp.PrintfLine("215 list follows")
+				dw := tp.DotWriter()
+				io.WriteString(dw, "misc.test 20 10 y\n.hidden 2 1 n\n")
+				dw.Close()
+			default:
+				tp.PrintfLine("500 what?")
+			}
+		}
+	}()
+	return cconn, got
+}
+
+func TestCompress(t *testing.T) {
+	conn, got := compressServer("COMPRESS DEFLATE")
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Compress(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.Compress(); err != ErrCompressionActive {
+		t.Fatalf("Expected ErrCompressionActive, got %v", err)
+	}
+
+	_, msg, err := cli.Command("DATE", 111)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "20190103185844" {
+		t.Fatalf("Expected date through the compressed stream, got %q", msg)
+	}
+
+	groups, err := cli.List("ACTIVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[1].Name != ".hidden" {
+		t.Fatalf("Unexpected groups: %#v", groups)
+	}
+
+	want := []string{"CAPABILITIES", "COMPRESS DEFLATE", "DATE", "LIST ACTIVE"}
+	for _, w := range want {
+		if l := <-got; l != w {
+			t.Fatalf("Expected server to read %q, got %q", w, l)
+		}
+	}
+}
+
+// Compression covers the whole connection, so article readers get
+// plain text without any decompression of their own.
+func TestCompressBody(t *testing.T) {
+	conn, _ := compressServer("COMPRESS DEFLATE")
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Compress(); err != nil {
+		t.Fatal(err)
+	}
+	_, _, r, err := cli.Body("<b@x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "plain text\n.leading dot\n" {
+		t.Fatalf("Unexpected body: %q", body)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatalf("Expected the connection to stay in sync, got %v", err)
+	}
+}
+
+func TestCompressNotSupported(t *testing.T) {
+	conn, got := compressServer("READER")
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Compress(); err != ErrCompressionNotSupported {
+		t.Fatalf("Expected ErrCompressionNotSupported, got %v", err)
+	}
+	cli.Close()
+	for l := range got {
+		if l == "COMPRESS DEFLATE" {
+			t.Fatal("COMPRESS should not have been sent")
+		}
+	}
+}
+
+func TestCompressTruncated(t *testing.T) {
+	conn, _ := compressServer("COMPRESS DEFLATE")
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Compress(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.CountArticlesExact("misc.test")
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+// oneByteConn returns at most one byte from each Read.
+type oneByteConn struct {
+	net.Conn
+}
+
+func (c oneByteConn) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return c.Conn.Read(p)
+}
+
+// The decompressor reads whatever the connection returns, so responses
+// and their terminators are found however the bytes are split up, and
+// an empty body is just the terminator.
+func TestCompressShortReads(t *testing.T) {
+	conn, _ := compressServer("COMPRESS DEFLATE")
+	cli, err := NewConn(oneByteConn{conn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Compress(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"<empty@x>", "<b@x>", "<empty@x>"} {
+		_, _, r, err := cli.Body(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		if id == "<b@x>" {
+			want = "plain text\n.leading dot\n"
+		}
+		if string(body) != want {
+			t.Errorf("%v: expected %q, got %q", id, want, body)
+		}
+	}
+	if _, msg, err := cli.Command("DATE", 111); err != nil || msg != "20190103185844" {
+		t.Fatalf("Expected the session to stay in sync, got %q, %v", msg, err)
+	}
+}
@@ -0,0 +1,384 @@
+package nntpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressWriter reports the running total written through it.
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+// BodyToFileWithProgress streams an article body to a file at path,
+// calling progress (if not nil) with the number of bytes written so
+// far and the total to expect.  The total is the article's size as
+// ArticleSize finds it before the transfer, which counts the headers
+// too, or -1 if the server doesn't say.
+//
+// The body is written to a temporary file in the same directory,
+// which is renamed to path once complete and removed on failure.  The
+// file gets the same permissions as any other new file (0666 less the
+// umask).
+func (c *Client) BodyToFileWithProgress(specifier, path string, progress func(written, total int64)) (int64, error) {
+	return c.bodyToFile(specifier, path, false, progress)
+}
+
+// DecodedToFileWithProgress is like BodyToFileWithProgress, but decodes
+// a yEnc encoded body as ArticleDecoded does.  The total passed to
+// progress is then the decoded size from the yEnc header.
+func (c *Client) DecodedToFileWithProgress(specifier, path string, progress func(written, total int64)) (int64, error) {
+	return c.bodyToFile(specifier, path, true, progress)
+}
+
+// createPart creates a temporary file in dir to be renamed to name once
+// complete.  Unlike os.CreateTemp, which uses 0600, the file is created
+// with 0666 less the umask, as the finished file should be.
+func createPart(dir, name string) (*os.File, error) {
+	for i := 0; i < 100; i++ {
+		path := filepath.Join(dir, fmt.Sprintf(".%s.%d.part", name, rand.Uint32()))
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: filepath.Join(dir, name), Err: fs.ErrExist}
+}
+
+func (c *Client) bodyToFile(specifier, path string, decode bool, progress func(int64, int64)) (int64, error) {
+	f, err := createPart(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.bodyTo(specifier, f, decode, progress)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+// BodyToContext copies an article body to w, giving up when ctx is
+// done.  Unlike a deadline on the command alone, this covers the whole
+// transfer, so a body that stalls part way is abandoned too.
+//
+// A cancelled transfer leaves the rest of the response unread, so the
+// client is closed and must be replaced (see Pool.Discard).  One that
+// completed anyway, as ctx was cancelled, is returned as a success.
+func (c *Client) BodyToContext(ctx context.Context, specifier string, w io.Writer) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	setDeadline := readDeadline(c.rwc)
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock the read in progress.
+			if setDeadline != nil {
+				setDeadline(time.Now())
+			} else {
+				c.rwc.Close()
+			}
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+	n, err := c.bodyTo(specifier, w, false, nil)
+	close(done)
+	if <-interrupted {
+		// bodyTo reads the whole body when it succeeds, so the
+		// connection is still in step if it beat the deadline.
+		if err == nil && setDeadline != nil {
+			setDeadline(time.Time{})
+			return n, nil
+		}
+		c.Close()
+		return n, ctx.Err()
+	}
+	return n, err
+}
+
+// bodyTo copies a body to w, always consuming all of it.  The size is
+// only looked up if there's a progress function to give it to.
+func (c *Client) bodyTo(specifier string, w io.Writer, decode bool, progress func(int64, int64)) (int64, error) {
+	total := int64(-1)
+	if progress != nil {
+		size, err := c.ArticleSize(specifier)
+		if IsConnectionError(err) {
+			return 0, err
+		}
+		if err == nil {
+			total = int64(size)
+		}
+	}
+	_, _, body, err := c.Body(specifier)
+	if err != nil {
+		return 0, err
+	}
+	defer io.Copy(io.Discard, body)
+
+	r := body
+	if decode {
+		if _, r, err = decodeBody(body); err != nil {
+			return 0, err
+		}
+		if y, ok := r.(*yencReader); ok {
+			total = y.size
+			if y.part > 0 {
+				total = y.end - y.begin + 1
+			}
+		}
+	}
+	pw := &progressWriter{w: w, total: total, progress: progress}
+	_, err = io.Copy(pw, r)
+	return pw.written, err
+}
+
+// ErrMissingParts is matched (with errors.Is) by the *MissingPartsError
+// returned by DownloadBinary.
+var ErrMissingParts = errors.New("binary has missing parts")
+
+// A MissingPartsError lists the article numbers of the parts of a
+// binary that the server no longer has, and the byte ranges of the
+// file (counting from 1, as yEnc does) that no fetched part covers.
+type MissingPartsError struct {
+	Subject string
+	Numbers []int64
+	Gaps    []Range
+}
+
+func (e *MissingPartsError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrMissingParts, e.Subject)
+	if len(e.Numbers) > 0 {
+		msg += fmt.Sprintf(": articles %v", e.Numbers)
+	}
+	if len(e.Gaps) > 0 {
+		msg += fmt.Sprintf(": bytes %v", e.Gaps)
+	}
+	return msg
+}
+
+func (e *MissingPartsError) Unwrap() error {
+	return ErrMissingParts
+}
+
+// binaryPart is one decoded part of a multipart binary, holding bytes
+// begin to end (from 1) of a file of size bytes.
+type binaryPart struct {
+	name       string
+	size       int64
+	begin, end int64
+	data       []byte
+}
+
+// fetchPart fetches and decodes the yEnc encoded body of one part.  A
+// single part body is taken to be the whole file.
+func fetchPart(c *Client, n int64) (*binaryPart, error) {
+	_, _, body, err := c.Body(fmt.Sprint(n))
+	if err != nil {
+		return nil, err
+	}
+	defer io.Copy(io.Discard, body)
+	y, err := newYencReader(bufio.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(y); err != nil {
+		return nil, err
+	}
+	p := &binaryPart{y.name, y.size, y.begin, y.end, buf.Bytes()}
+	if y.part == 0 {
+		p.begin, p.end = 1, int64(len(p.data))
+		if p.size == 0 {
+			p.size = p.end
+		}
+	}
+	if p.begin < 1 || p.end > p.size || p.end-p.begin+1 != int64(len(p.data)) {
+		return nil, fmt.Errorf("%w: part holds %v bytes for %v-%v of %v",
+			ErrBadYenc, len(p.data), p.begin, p.end, p.size)
+	}
+	return p, nil
+}
+
+// assembleParts checks that the parts are of one file and between them
+// cover all of it exactly once, returning them in file order.  Gaps
+// are returned as a *MissingPartsError, alongside the missing articles.
+func assembleParts(subject string, got []*binaryPart, missing []int64) ([]*binaryPart, error) {
+	var parts []*binaryPart
+	for _, p := range got {
+		if p != nil {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, &MissingPartsError{Subject: subject, Numbers: missing}
+	}
+	first := parts[0]
+	for _, p := range parts[1:] {
+		if p.name != first.name || p.size != first.size {
+			return nil, fmt.Errorf("%w: parts of both %q (%v bytes) and %q (%v bytes)",
+				ErrBadYenc, first.name, first.size, p.name, p.size)
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].begin < parts[j].begin })
+	var gaps []Range
+	next := int64(1)
+	for _, p := range parts {
+		if p.begin < next {
+			return nil, fmt.Errorf("%w: parts overlap at byte %v", ErrBadYenc, p.begin)
+		}
+		if p.begin > next {
+			gaps = append(gaps, Range{next, p.begin - 1})
+		}
+		next = p.end + 1
+	}
+	if next <= first.size {
+		gaps = append(gaps, Range{next, first.size})
+	}
+	if len(missing) > 0 || len(gaps) > 0 {
+		return nil, &MissingPartsError{subject, missing, gaps}
+	}
+	return parts, nil
+}
+
+// DownloadBinary fetches the yEnc encoded parts of a multipart binary
+// posted to group, given their article numbers (as found by grouping
+// overviews by subject), and writes the assembled file to outDir.  The
+// file's name comes from the yEnc header, falling back to the subject.
+//
+// Parts are fetched in parallel with as many clients as the pool
+// allows, and held in memory until all have arrived.  Each is written
+// at the offset its yEnc header gives.  If the server lacks any part,
+// or the parts leave some of the file uncovered, nothing is written and
+// the error is a *MissingPartsError.  Parts of different files, or
+// overlapping parts, are refused as ErrBadYenc.  Otherwise the first
+// part that couldn't be fetched or decoded is reported by article
+// number.
+func DownloadBinary(pool *Pool, group, subject string, parts []int64, outDir string) (filename string, err error) {
+	got := make([]*binaryPart, len(parts))
+	errs := make([]error, len(parts))
+	next := make(chan int, len(parts))
+	for i := range parts {
+		next <- i
+	}
+	close(next)
+
+	// A worker whose connection fails stops, leaving its remaining
+	// parts to the others.
+	var mu sync.Mutex
+	var failed error
+	fail := func(err error) {
+		mu.Lock()
+		if failed == nil {
+			failed = err
+		}
+		mu.Unlock()
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < pool.cfg.Size && w < len(parts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := pool.Get(context.Background())
+			if err != nil {
+				fail(err)
+				return
+			}
+			if _, err = c.Group(group); err != nil {
+				pool.Discard(c)
+				fail(err)
+				return
+			}
+			for i := range next {
+				got[i], errs[i] = fetchPart(c, parts[i])
+				// A part that fails to decode has still been read
+				// in full, so the connection is fine.
+				if IsConnectionError(errs[i]) {
+					pool.Discard(c)
+					fail(errs[i])
+					return
+				}
+			}
+			pool.Put(c)
+		}()
+	}
+	wg.Wait()
+	for i := range parts {
+		if got[i] == nil && errs[i] == nil {
+			errs[i] = failed
+		}
+	}
+
+	var missing []int64
+	for i, err := range errs {
+		if isNoArticle(err) {
+			missing = append(missing, parts[i])
+		} else if err != nil {
+			return "", fmt.Errorf("article %d: %w", parts[i], err)
+		}
+	}
+	assembled, err := assembleParts(subject, got, missing)
+	if err != nil {
+		return "", err
+	}
+
+	name := assembled[0].name
+	if name == "" {
+		name = subject
+	}
+	filename = filepath.Join(outDir, filepath.Base(name))
+	f, err := createPart(outDir, filepath.Base(name))
+	if err != nil {
+		return "", err
+	}
+	for _, p := range assembled {
+		if _, err = f.WriteAt(p.data, p.begin-1); err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return filename, nil
+}
@@ -0,0 +1,390 @@
+package nntpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyToFileWithProgress(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20000; i++ {
+		lines = append(lines, strings.Repeat("abcdefgh", 16))
+	}
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HDR", 225, "Headers follow", "0 2600000")
+	stub.PrepareDotPayloadResponseArray("BODY", 222, "0 <big@x>", lines)
+	stub.PrepareResponse("DATE", 111, "20190103185844")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "big.bin")
+	var calls int
+	var last int64
+	n, err := cli.BodyToFileWithProgress("<big@x>", path, func(written, total int64) {
+		if written < last {
+			t.Errorf("Progress went backwards: %v after %v", written, last)
+		}
+		if total != 2600000 {
+			t.Errorf("Expected the HDR :bytes total, got %v", total)
+		}
+		calls++
+		last = written
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := int64(20000 * (128 + 1))
+	if n != want || last != want {
+		t.Errorf("Expected %v bytes, got %v (progress %v)", want, n, last)
+	}
+	if calls < 2 {
+		t.Errorf("Expected several progress calls, got %v", calls)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != want || !bytes.HasPrefix(data, []byte("abcdefgh")) {
+		t.Errorf("Unexpected file contents (%v bytes)", len(data))
+	}
+	// The same mode as any new file, not CreateTemp's 0600.
+	ref, err := os.Create(filepath.Join(filepath.Dir(path), "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	refInfo, _ := os.Stat(ref.Name())
+	info, _ := os.Stat(path)
+	if info.Mode() != refInfo.Mode() {
+		t.Errorf("Expected mode %v, got %v", refInfo.Mode(), info.Mode())
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBodyToFileCleansUp(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("BODY", 430, "No such article")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if _, err = cli.BodyToFileWithProgress("<gone@x>", filepath.Join(dir, "gone"), nil); err == nil {
+		t.Fatal("Expected an error for a missing article")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no files left behind, got %v", entries)
+	}
+}
+
+func TestDecodedToFileWithProgress(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, '=', '\r', '\n', 250, 255}, 4096)
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("HDR", 225, "Headers follow", "0 50000")
+	stub.PrepareDotPayloadResponseArray("BODY", 222, "0 <bin@x>", yencPayload("bin.dat", data))
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bin.dat")
+	var total int64
+	n, err := cli.DecodedToFileWithProgress("<bin@x>", path, func(_, size int64) {
+		total = size
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(got, data) {
+		t.Errorf("Decoded %v bytes, expected %v", n, len(data))
+	}
+	if total != int64(len(data)) {
+		t.Errorf("Expected the yEnc size as the total, got %v", total)
+	}
+}
+
+// yencPartPayload encodes one part of a multipart binary.
+func yencPartPayload(name string, part, total int, begin int, data []byte, size int) []string {
+	lines := []string{
+		fmt.Sprintf("=ybegin part=%d total=%d line=128 size=%d name=%s", part, total, size, name),
+		fmt.Sprintf("=ypart begin=%d end=%d", begin, begin+len(data)-1),
+	}
+	lines = append(lines, yencEncode(data)...)
+	return append(lines, fmt.Sprintf("=yend size=%d part=%d", len(data), part))
+}
+
+func binaryPool(bodies map[string][]string, missing ...string) *Pool {
+	return NewPool(PoolConfig{Size: 2, Dial: func() (*Client, error) {
+		stub := NewStub(200, "Stub")
+		stub.PrepareResponse("GROUP", 211, "2 10 11 alt.binaries.test")
+		for cmd, payload := range bodies {
+			stub.PrepareDotPayloadResponseArray(cmd, 222, "0 <part@x>", payload)
+		}
+		for _, cmd := range missing {
+			stub.PrepareResponse(cmd, 423, "No article with that number")
+		}
+		return NewConn(stub)
+	}})
+}
+
+func TestDownloadBinary(t *testing.T) {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	// Article 10 holds the second part, and 11 the first.
+	pool := binaryPool(map[string][]string{
+		"BODY 10": yencPartPayload("file.bin", 2, 2, 2001, data[2000:], len(data)),
+		"BODY 11": yencPartPayload("file.bin", 1, 2, 1, data[:2000], len(data)),
+	})
+	defer pool.Close()
+
+	dir := t.TempDir()
+	name, err := DownloadBinary(pool, "alt.binaries.test", "file.bin (1/2)", []int64{10, 11}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != filepath.Join(dir, "file.bin") {
+		t.Errorf("Unexpected file name %q", name)
+	}
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Assembled file differs: %v bytes", len(got))
+	}
+}
+
+func TestDownloadBinaryMissingPart(t *testing.T) {
+	data := []byte("first part only")
+	pool := binaryPool(map[string][]string{
+		"BODY 10": yencPartPayload("file.bin", 1, 2, 1, data, 100),
+	}, "BODY 11")
+	defer pool.Close()
+
+	dir := t.TempDir()
+	_, err := DownloadBinary(pool, "alt.binaries.test", "file.bin (1/2)", []int64{10, 11}, dir)
+	var me *MissingPartsError
+	if !errors.Is(err, ErrMissingParts) || !errors.As(err, &me) {
+		t.Fatalf("Expected a MissingPartsError, got %v", err)
+	}
+	if len(me.Numbers) != 1 || me.Numbers[0] != 11 {
+		t.Errorf("Expected article 11 missing, got %v", me.Numbers)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, found %v", entries)
+	}
+}
+
+func TestDownloadBinaryGap(t *testing.T) {
+	data := make([]byte, 300)
+	pool := binaryPool(map[string][]string{
+		"BODY 10": yencPartPayload("file.bin", 1, 3, 1, data[:100], len(data)),
+		"BODY 12": yencPartPayload("file.bin", 3, 3, 201, data[200:], len(data)),
+	})
+	defer pool.Close()
+
+	dir := t.TempDir()
+	// Article 11, with the middle part, wasn't asked for.
+	_, err := DownloadBinary(pool, "alt.binaries.test", "file.bin (1/3)", []int64{10, 12}, dir)
+	var me *MissingPartsError
+	if !errors.As(err, &me) {
+		t.Fatalf("Expected a MissingPartsError, got %v", err)
+	}
+	if len(me.Numbers) != 0 || len(me.Gaps) != 1 || me.Gaps[0] != (Range{101, 200}) {
+		t.Errorf("Expected bytes 101-200 missing, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, found %v", entries)
+	}
+}
+
+func TestDownloadBinaryInconsistentParts(t *testing.T) {
+	data := make([]byte, 200)
+	tests := []struct {
+		name   string
+		bodies map[string][]string
+	}{
+		{"duplicate", map[string][]string{
+			"BODY 10": yencPartPayload("file.bin", 1, 2, 1, data[:100], len(data)),
+			"BODY 11": yencPartPayload("file.bin", 1, 2, 1, data[:100], len(data)),
+			"BODY 12": yencPartPayload("file.bin", 2, 2, 101, data[100:], len(data)),
+		}},
+		{"other file", map[string][]string{
+			"BODY 10": yencPartPayload("file.bin", 1, 2, 1, data[:100], len(data)),
+			"BODY 11": yencPartPayload("other.bin", 2, 2, 101, data[100:], len(data)),
+		}},
+	}
+	for _, test := range tests {
+		pool := binaryPool(test.bodies)
+		var parts []int64
+		for n := int64(10); n < int64(10+len(test.bodies)); n++ {
+			parts = append(parts, n)
+		}
+		dir := t.TempDir()
+		_, err := DownloadBinary(pool, "alt.binaries.test", "file.bin", parts, dir)
+		if !errors.Is(err, ErrBadYenc) {
+			t.Errorf("%v: expected ErrBadYenc, got %v", test.name, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%v: expected nothing written, found %v", test.name, entries)
+		}
+		pool.Close()
+	}
+}
+
+func TestDownloadBinaryBadPartKeepsClient(t *testing.T) {
+	data := []byte("second part")
+	dials := 0
+	var stub *stubReaderWriter
+	pool := NewPool(PoolConfig{Size: 1, Dial: func() (*Client, error) {
+		dials++
+		stub = NewStub(200, "Stub")
+		stub.PrepareResponse("GROUP", 211, "2 10 11 alt.binaries.test")
+		stub.PrepareDotPayloadResponse("BODY 10", 222, "10 <part@x>", "not yEnc at all")
+		stub.PrepareDotPayloadResponseArray("BODY 11", 222, "11 <part@x>",
+			yencPartPayload("file.bin", 2, 2, 101, data, 100+len(data)))
+		return NewConn(stub)
+	}})
+	defer pool.Close()
+
+	_, err := DownloadBinary(pool, "alt.binaries.test", "file.bin (1/2)", []int64{10, 11}, t.TempDir())
+	if !errors.Is(err, ErrBadYenc) || !strings.Contains(err.Error(), "article 10") {
+		t.Fatalf("Expected a yEnc error for article 10, got %v", err)
+	}
+	if dials != 1 || !HasReceivedLine(stub, "BODY 11") {
+		t.Errorf("Expected the same client to fetch the next part, got %v dials", dials)
+	}
+	if len(pool.idle) != 1 {
+		t.Errorf("Expected the client back in the pool")
+	}
+}
+
+func TestBodyToContextCancelled(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go func() {
+		fmt.Fprintf(s, "200 Stub\r\n")
+		r := bufio.NewReader(s)
+		r.ReadString('\n')
+		fmt.Fprintf(s, "222 0 <slow@x>\r\nfirst line\r\n")
+		// Then stall mid-body.
+		io.Copy(io.Discard, r)
+	}()
+	cli, err := NewConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	n, err := cli.BodyToContext(ctx, "<slow@x>", &buf)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	if n != int64(buf.Len()) || !strings.HasPrefix(buf.String(), "first line") {
+		t.Errorf("Expected the first line copied, got %v bytes %q", n, buf.String())
+	}
+	if _, err = cli.Date(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected the client to be closed, got %v", err)
+	}
+}
+
+func TestBodyToContext(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("BODY", 222, "0 <a@x>", "hello", "world")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = cli.BodyToContext(context.Background(), "<a@x>", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello\nworld\n" {
+		t.Errorf("Unexpected body %q", buf.String())
+	}
+}
+
+// cancelWriter cancels a context on its first write, then waits for
+// the cancellation to interrupt the transport before going on.
+type cancelWriter struct {
+	bytes.Buffer
+	cancel      func()
+	interrupted chan struct{}
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+		<-w.interrupted
+	}
+	return w.Buffer.Write(p)
+}
+
+// signalTransport closes interrupted when a deadline is set.
+type signalTransport struct {
+	*mockTransport
+	interrupted chan struct{}
+}
+
+func (s *signalTransport) SetDeadline(t time.Time) error {
+	s.mockTransport.SetDeadline(t)
+	if !t.IsZero() {
+		close(s.interrupted)
+	}
+	return nil
+}
+
+func TestBodyToContextCompletesAsCancelled(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("BODY", 222, "0 <a@x>", "hello", "world")
+	stub.PrepareResponse("DATE", 111, "20190103180000")
+	tr := &signalTransport{&mockTransport{stubReaderWriter: stub}, make(chan struct{})}
+	cli, err := NewTransport(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelWriter{cancel: cancel, interrupted: tr.interrupted}
+	if _, err = cli.BodyToContext(ctx, "<a@x>", w); err != nil {
+		t.Fatalf("Expected the finished transfer to succeed, got %v", err)
+	}
+	if w.String() != "hello\nworld\n" {
+		t.Errorf("Unexpected body %q", w.String())
+	}
+	if len(tr.deadlines) != 2 || tr.deadlines[0].IsZero() || !tr.deadlines[1].IsZero() {
+		t.Errorf("Expected the transport deadline set and cleared, got %v", tr.deadlines)
+	}
+	if _, err = cli.Date(); err != nil {
+		t.Errorf("Expected the client to stay usable, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package nntpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+)
+
+// An Error is a response from the server that didn't carry the
+// expected code.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%03d %s", e.Code, e.Msg)
+}
+
+// Is matches any Error with the same response code, so for example
+// errors.Is(err, ErrSecureConnectionRequired) holds for every 483.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// As allows an Error to be treated as the *textproto.Error it was
+// derived from.
+func (e *Error) As(target interface{}) bool {
+	t, ok := target.(**textproto.Error)
+	if ok {
+		*t = &textproto.Error{Code: e.Code, Msg: e.Msg}
+	}
+	return ok
+}
+
+// ErrSecureConnectionRequired is returned when the server refuses a
+// command (typically AUTHINFO) until the connection is encrypted.
+var ErrSecureConnectionRequired = &Error{483, "secure connection required"}
+
+// ErrAuthRejected is returned for a 481: the credentials (or other
+// authentication exchange) were refused.
+var ErrAuthRejected = &Error{481, "authentication failed"}
+
+// ErrAuthOutOfSequence is returned for a 482: authentication commands
+// were sent in the wrong order.
+var ErrAuthOutOfSequence = &Error{482, "authentication commands issued out of sequence"}
+
+// ErrAuthRequired is returned for a 480: the command needs the client
+// to authenticate first.
+var ErrAuthRequired = &Error{480, "authentication required"}
+
+// ErrWrongMode is returned for a 401: the server must be switched to a
+// different mode (such as with MODE READER) first.
+var ErrWrongMode = &Error{401, "wrong mode"}
+
+// A CommandError is a response refusing a command until something
+// about the session changes, such as authenticating.  Command records
+// the command so the caller can retry it.
+type CommandError struct {
+	Command string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return e.Command + ": " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ErrCommandUnavailable is returned for a 502: the command exists but
+// isn't available to this session (not permitted or not provided).
+var ErrCommandUnavailable = &Error{502, "command unavailable"}
+
+// ErrUnknownCommand is returned for a 500: the server doesn't know the
+// command at all.
+var ErrUnknownCommand = &Error{500, "unknown command"}
+
+// IsUnsupported reports whether err means a command isn't available
+// (500 or 502), so a caller can degrade gracefully, for example from
+// OVER to HDR to fetching headers.
+func IsUnsupported(err error) bool {
+	return errors.Is(err, ErrCommandUnavailable) || errors.Is(err, ErrUnknownCommand)
+}
+
+// ErrNoGroupSelected is returned for a 412: the command needs a group
+// selected with Group first.
+var ErrNoGroupSelected = &Error{412, "no newsgroup selected"}
+
+// ErrNoCurrentArticle is returned for a 420, or without asking the
+// server when no article is known to be current.
+var ErrNoCurrentArticle = &Error{420, "no current article selected"}
+
+// ErrNoSuchGroup is returned when selecting a group the server doesn't
+// have.  The error returned by Group is a *GroupError naming the group.
+var ErrNoSuchGroup = &Error{411, "no such newsgroup"}
+
+// A GroupError reports a failure relating to a particular group.
+type GroupError struct {
+	Group string
+	Err   error
+}
+
+func (e *GroupError) Error() string {
+	return e.Group + ": " + e.Err.Error()
+}
+
+func (e *GroupError) Unwrap() error {
+	return e.Err
+}
+
+// errPostingFailed is the per-article rejection of a POST.
+var errPostingFailed = &Error{441, "posting failed"}
+
+// responseError converts textproto's code errors into an *Error.
+// Other errors are returned unchanged.
+func responseError(err error) error {
+	if e, ok := err.(*textproto.Error); ok {
+		return &Error{Code: e.Code, Msg: e.Msg}
+	}
+	return err
+}
+
+// readCodeLine reads a response line, expecting a code as described by
+// Command.  Any pipelined commands still buffered are sent first.
+func readCodeLine(conn *textproto.Conn, expectCode int) (int, string, error) {
+	if err := conn.W.Flush(); err != nil {
+		return 0, "", err
+	}
+	code, msg, err := conn.ReadCodeLine(expectCode)
+	return code, msg, responseError(err)
+}
+
+// IsTransient reports whether an operation that failed with err might
+// succeed if retried: connection failures, 400 (service temporarily
+// unavailable) and 503 (temporary failure).  Other response codes, such
+// as 411 or 430, are permanent.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == 400 || e.Code == 503
+	}
+	return IsConnectionError(err)
+}
+
+// IsConnectionError reports whether err is a failure of the connection
+// itself rather than a response from the server, meaning the session
+// can't be used any further.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		// The server closes the connection after a 400.
+		return e.Code == 400
+	}
+	var ne net.Error
+	return err == io.EOF || err == io.ErrUnexpectedEOF ||
+		errors.As(err, &ne) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,248 @@
+package nntpclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/knothon/go-nntp"
+)
+
+// GroupFS selects a group and presents it as a read-only file system,
+// so io/fs tools (fs.WalkDir, fs.Glob and so on) can be used on it.
+//
+// The group is a single directory in which each article is a file
+// named by its number, holding the article's body.  Listing the
+// directory uses LISTGROUP, then OVER for the whole range.  Opening a
+// file fetches the whole body into memory, so the client is free for
+// other commands while it's being read.  The file system uses the
+// client, so it can't be shared between goroutines.
+//
+// A file's size is the article size the overview gives (:bytes), so
+// it can be known without fetching the article.  That counts the
+// headers too, making it more than the length of the body read.  It's
+// 0 if the server has no overview for the article.
+func (c *Client) GroupFS(group string) (fs.FS, error) {
+	if _, err := c.Group(group); err != nil {
+		return nil, err
+	}
+	return &groupFS{c, group, map[string]int64{}}, nil
+}
+
+type groupFS struct {
+	c     *Client
+	group string
+	sizes map[string]int64
+}
+
+// selectGroup re-selects the group if the client has moved on.
+func (g *groupFS) selectGroup() error {
+	if g.c.group == g.group {
+		return nil
+	}
+	_, err := g.c.Group(g.group)
+	return err
+}
+
+// body fetches an article's body by number, re-selecting the group if
+// the client has moved on or the server has lost the selection.
+func (g *groupFS) body(name string) (io.Reader, error) {
+	if err := g.selectGroup(); err != nil {
+		return nil, err
+	}
+	_, _, r, err := g.c.Body(name)
+	if errors.Is(err, ErrNoGroupSelected) {
+		if _, err = g.c.Group(g.group); err != nil {
+			return nil, err
+		}
+		_, _, r, err = g.c.Body(name)
+	}
+	if isNoArticle(err) {
+		err = fs.ErrNotExist
+	}
+	return r, err
+}
+
+// validArticle reports whether name is an article number in canonical
+// form, so each article has exactly one name.
+func validArticle(name string) bool {
+	n, err := strconv.ParseInt(name, 10, 64)
+	return err == nil && n >= 0 && strconv.FormatInt(n, 10) == name
+}
+
+func (g *groupFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &groupDir{fs: g}, nil
+	}
+	if !validArticle(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	r, err := g.body(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info, err := g.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &articleFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// overviewSizes records the overview sizes of the articles in r.  A
+// server without overviews leaves them unknown.
+func (g *groupFS) overviewSizes(r Range) error {
+	if err := g.selectGroup(); err != nil {
+		return err
+	}
+	err := g.c.OverStream(r, func(o *nntp.ArticleOverview) error {
+		g.sizes[strconv.FormatUint(o.Id, 10)] = int64(o.Bytes)
+		return nil
+	})
+	if IsUnsupported(err) || errors.Is(err, ErrNoOverviewFormat) {
+		return nil
+	}
+	return err
+}
+
+// stat returns an article's info, asking for its overview if its size
+// isn't known yet.
+func (g *groupFS) stat(name string) (articleInfo, error) {
+	if _, ok := g.sizes[name]; !ok {
+		n, _ := strconv.ParseInt(name, 10, 64)
+		if err := g.overviewSizes(Range{n, n}); err != nil {
+			return articleInfo{}, err
+		}
+		if _, ok := g.sizes[name]; !ok {
+			// Remember that there's none, rather than asking again.
+			g.sizes[name] = 0
+		}
+	}
+	return articleInfo{name: name, size: g.sizes[name]}, nil
+}
+
+// ReadDir lists the articles in the group, sorted by name as fs.ReadDir
+// requires (so "10" comes before "9").
+func (g *groupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		if !fs.ValidPath(name) {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var rv []fs.DirEntry
+	_, err := g.c.listGroup(g.group, "", func(n int64) error {
+		rv = append(rv, articleEntry{g, strconv.FormatInt(n, 10)})
+		return nil
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(rv) > 0 {
+		first, _ := strconv.ParseInt(rv[0].Name(), 10, 64)
+		last, _ := strconv.ParseInt(rv[len(rv)-1].Name(), 10, 64)
+		if err = g.overviewSizes(Range{first, last}); err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name() < rv[j].Name() })
+	return rv, nil
+}
+
+// articleEntry is a listed article.  Info only asks the server for the
+// article's overview if ReadDir couldn't get it.
+type articleEntry struct {
+	fs   *groupFS
+	name string
+}
+
+func (e articleEntry) Name() string      { return e.name }
+func (e articleEntry) IsDir() bool       { return false }
+func (e articleEntry) Type() fs.FileMode { return 0 }
+func (e articleEntry) Info() (fs.FileInfo, error) {
+	info, err := e.fs.stat(e.name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: e.name, Err: err}
+	}
+	return info, nil
+}
+
+// articleInfo describes an article file, or with dir the group.
+type articleInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i articleInfo) Name() string       { return i.name }
+func (i articleInfo) Size() int64        { return i.size }
+func (i articleInfo) ModTime() time.Time { return time.Time{} }
+func (i articleInfo) IsDir() bool        { return i.dir }
+func (i articleInfo) Sys() interface{}   { return nil }
+
+func (i articleInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// articleFile is an opened article body.
+type articleFile struct {
+	*bytes.Reader
+	info articleInfo
+}
+
+func (f *articleFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *articleFile) Close() error               { return nil }
+
+// groupDir is the opened group directory.
+type groupDir struct {
+	fs      *groupFS
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *groupDir) Stat() (fs.FileInfo, error) {
+	return articleInfo{name: ".", dir: true}, nil
+}
+
+func (d *groupDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+func (d *groupDir) Close() error { return nil }
+
+func (d *groupDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	if n <= 0 {
+		rv := d.entries
+		d.entries = nil
+		return rv, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	rv := d.entries[:n]
+	d.entries = d.entries[n:]
+	return rv, nil
+}
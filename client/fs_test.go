@@ -0,0 +1,129 @@
+package nntpclient
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func groupFSStub() *stubReaderWriter {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "2 9 10 misc.test")
+	stub.PrepareDotPayloadResponse("LISTGROUP", 211, "2 9 10 misc.test", "9", "10")
+	stub.PrepareDotPayloadResponse("BODY 9", 222, "9 <9@x>", "ninth", "article")
+	stub.PrepareDotPayloadResponse("BODY 10", 222, "10 <10@x>", "tenth")
+	stub.PrepareResponse("BODY 11", 423, "No article with that number")
+	stub.PrepareDotPayloadResponse("LIST", 215, "Order of fields in overview database.",
+		"Subject:", "From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview follows",
+		"9\tninth\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<9@x>\t\t140\t2",
+		"10\ttenth\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<10@x>\t\t120\t1")
+	return stub
+}
+
+func TestGroupFSOpen(t *testing.T) {
+	cli, err := NewConn(groupFSStub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := cli.GroupFS("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ninth\narticle\n" {
+		t.Errorf("Unexpected body %q", data)
+	}
+	info, err := f.Stat()
+	if err != nil || info.Name() != "9" || info.Size() != 140 || info.IsDir() {
+		t.Errorf("Unexpected info %v, %v", info, err)
+	}
+
+	if _, err = fsys.Open("11"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for a missing article, got %v", err)
+	}
+	if _, err = fsys.Open("x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for a bad name, got %v", err)
+	}
+}
+
+func TestGroupFSTestFS(t *testing.T) {
+	cli, err := NewConn(groupFSStub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := cli.GroupFS("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fstest.TestFS(fsys, "9", "10"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupFSReselectsGroup(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "2 9 10 misc.test")
+	// As when the server has forgotten the selection.
+	stub.PrepareResponse("BODY 9", 412, "No newsgroup selected")
+	stub.PrepareDotPayloadResponse("BODY 9", 222, "9 <9@x>", "ninth")
+	stub.PrepareResponse("LIST", 503, "No overview")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := cli.GroupFS("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "9")
+	if err != nil || string(data) != "ninth\n" {
+		t.Errorf("Unexpected file %q, %v", data, err)
+	}
+	if n := CountReceivedRequests(stub, "GROUP"); n != 2 {
+		t.Errorf("Expected the group to be selected again, got %v GROUPs", n)
+	}
+}
+
+func TestGroupFSInfoWithoutBody(t *testing.T) {
+	stub := groupFSStub()
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := cli.GroupFS("misc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	if len(sizes) != 2 || sizes[0] != 120 || sizes[1] != 140 {
+		t.Errorf("Expected the overview sizes of 10 and 9, got %v", sizes)
+	}
+	if CountReceivedRequests(stub, "BODY") != 0 || CountReceivedRequests(stub, "OVER") != 1 {
+		t.Errorf("Expected one OVER and no BODY, got %q", stub.receivedLines)
+	}
+}
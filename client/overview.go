@@ -0,0 +1,55 @@
+package nntpclient
+
+import (
+	"github.com/knothon/go-nntp"
+)
+
+// An OverviewSet is a batch of overview results with lookup helpers.
+// Results from Over and friends convert directly:
+//
+//	set := OverviewSet(overviews)
+type OverviewSet []*nntp.ArticleOverview
+
+// ByNumber finds the overview for an article number.
+func (s OverviewSet) ByNumber(n int64) (*nntp.ArticleOverview, bool) {
+	if n < 0 {
+		return nil, false
+	}
+	for _, o := range s {
+		if o.Id == uint64(n) {
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+// ByMessageID finds the overview for a message-id.
+func (s OverviewSet) ByMessageID(id string) (*nntp.ArticleOverview, bool) {
+	for _, o := range s {
+		if o.MessageId == id {
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+// Numbers returns the article numbers in the set, in order.
+func (s OverviewSet) Numbers() []int64 {
+	rv := make([]int64, len(s))
+	for i, o := range s {
+		rv[i] = int64(o.Id)
+	}
+	return rv
+}
+
+// WithoutControl returns the overviews that don't look like control
+// messages (see nntp.ArticleOverview.IsControl).
+func (s OverviewSet) WithoutControl() OverviewSet {
+	rv := make(OverviewSet, 0, len(s))
+	for _, o := range s {
+		if !o.IsControl() {
+			rv = append(rv, o)
+		}
+	}
+	return rv
+}
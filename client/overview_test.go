@@ -0,0 +1,57 @@
+package nntpclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverviewSet(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("LIST", 215, "List Format:", "Subject:",
+		"From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"1\tone\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1",
+		"2\ttwo\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1",
+		"3\tthree\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<3@x>\t\t10\t1")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := cli.Over(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := OverviewSet(rv)
+
+	if got := set.Numbers(); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("Unexpected numbers %v", got)
+	}
+	if o, ok := set.ByNumber(2); !ok || o != rv[1] {
+		t.Errorf("Expected article 2, got %v, %v", o, ok)
+	}
+	if o, ok := set.ByMessageID("<3@x>"); !ok || o != rv[2] {
+		t.Errorf("Expected article 3, got %v, %v", o, ok)
+	}
+	if _, ok := set.ByNumber(4); ok {
+		t.Error("Expected article 4 to be missing")
+	}
+	if _, ok := set.ByMessageID("<missing@x>"); ok {
+		t.Error("Expected <missing@x> to be missing")
+	}
+}
+
+func TestOverviewSetWithoutControl(t *testing.T) {
+	set := OverviewSet{
+		{Id: 1, Subject: "Hello", MessageId: "<1@x>"},
+		{Id: 2, Subject: "cmsg cancel <1@x>", MessageId: "<2@x>"},
+		{Id: 3, Subject: "CMSG newgroup misc.new", MessageId: "<3@x>"},
+		{Id: 4, Subject: "cancel <1@x>", MessageId: "<4@x>"},
+		{Id: 5, Subject: "Re: cmsg cancel explained", MessageId: "<5@x>"},
+		{Id: 6, Subject: "Subject: cmsg rmgroup misc.old", MessageId: "<6@x>"},
+		{Id: 7, Subject: "whatever", MessageId: "<cancel.1@x>"},
+	}
+	got := set.WithoutControl().Numbers()
+	if !reflect.DeepEqual(got, []int64{1, 5}) {
+		t.Errorf("Expected articles 1 and 5 left, got %v", got)
+	}
+}
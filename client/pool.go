@@ -0,0 +1,160 @@
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolExhausted is returned by Pool.Get when no client became
+// available within the allowed wait.
+var ErrPoolExhausted = errors.New("connection pool exhausted")
+
+// ErrPoolClosed is returned by Pool.Get after the pool has been closed.
+var ErrPoolClosed = errors.New("connection pool closed")
+
+// PoolConfig describes how a Pool opens and validates its clients.
+type PoolConfig struct {
+	// Dial opens a new connected (and, if needed, authenticated) client.
+	Dial func() (*Client, error)
+	// Size is the maximum number of open clients.
+	Size int
+	// MaxWait bounds how long Get waits for a client to free up, in
+	// addition to any deadline on the context.  Zero means only the
+	// context applies.
+	MaxWait time.Duration
+	// HealthCheck is run against an idle client before it's handed
+	// out.  Clients that fail are closed and replaced.  May be nil.
+	HealthCheck func(*Client) error
+}
+
+// A Pool hands out a bounded number of clients to concurrent users.
+type Pool struct {
+	cfg   PoolConfig
+	idle  chan *Client
+	slots chan struct{}
+	done  chan struct{}
+	// mu orders Put against Close, so nothing lands in idle after
+	// it's been drained.
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+// NewPool builds a pool from the given config.  No connections are
+// opened until they're first needed.
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.Size < 1 {
+		cfg.Size = 1
+	}
+	return &Pool{
+		cfg:   cfg,
+		idle:  make(chan *Client, cfg.Size),
+		slots: make(chan struct{}, cfg.Size),
+		done:  make(chan struct{}),
+	}
+}
+
+// Get a client from the pool, opening one if there's room.
+//
+// If all clients are in use, Get waits until one is returned, the
+// context is done or MaxWait elapses.  A timeout is reported as
+// ErrPoolExhausted.
+func (p *Pool) Get(ctx context.Context) (*Client, error) {
+	var timeout <-chan time.Time
+	if p.cfg.MaxWait > 0 {
+		t := time.NewTimer(p.cfg.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for {
+		select {
+		case <-p.done:
+			return nil, ErrPoolClosed
+		default:
+		}
+
+		select {
+		case c := <-p.idle:
+			return p.checked(c)
+		case p.slots <- struct{}{}:
+			return p.dial()
+		default:
+		}
+
+		select {
+		case c := <-p.idle:
+			return p.checked(c)
+		case p.slots <- struct{}{}:
+			return p.dial()
+		case <-p.done:
+			return nil, ErrPoolClosed
+		case <-timeout:
+			return nil, ErrPoolExhausted
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrPoolExhausted
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checked validates an idle client, replacing it in the same slot if
+// it's no longer healthy.
+func (p *Pool) checked(c *Client) (*Client, error) {
+	if p.cfg.HealthCheck == nil || p.cfg.HealthCheck(c) == nil {
+		return c, nil
+	}
+	c.Close()
+	return p.dial()
+}
+
+// dial opens a client for a slot that has already been acquired.
+func (p *Pool) dial() (*Client, error) {
+	c, err := p.cfg.Dial()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put returns a client to the pool for reuse.
+func (p *Pool) Put(c *Client) {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		p.Discard(c)
+	default:
+		p.idle <- c
+		p.mu.Unlock()
+	}
+}
+
+// Discard closes a client that's no longer usable and frees its slot.
+func (p *Pool) Discard(c *Client) {
+	c.Close()
+	<-p.slots
+}
+
+// Close the pool and all idle clients.  Clients currently checked out
+// are closed when they're returned.  Closing a closed pool does
+// nothing.
+func (p *Pool) Close() error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		close(p.done)
+		p.mu.Unlock()
+	})
+	for {
+		select {
+		case c := <-p.idle:
+			p.Discard(c)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package nntpclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func stubDialer(dials *int) func() (*Client, error) {
+	return func() (*Client, error) {
+		*dials++
+		return NewConn(NewStub(200, "Stub"))
+	}
+}
+
+func TestPoolExhausted(t *testing.T) {
+	dials := 0
+	p := NewPool(PoolConfig{Dial: stubDialer(&dials), Size: 1,
+		MaxWait: 10 * time.Millisecond})
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Get(context.Background())
+	if err != ErrPoolExhausted {
+		t.Fatalf("Expected ErrPoolExhausted, got %v", err)
+	}
+
+	p.Put(c)
+	c2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 != c {
+		t.Fatal("Expected the returned client to be reused")
+	}
+	if dials != 1 {
+		t.Fatalf("Expected 1 dial, got %v", dials)
+	}
+}
+
+func TestPoolContextDeadline(t *testing.T) {
+	dials := 0
+	p := NewPool(PoolConfig{Dial: stubDialer(&dials), Size: 1})
+	defer p.Close()
+
+	if _, err := p.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != ErrPoolExhausted {
+		t.Fatalf("Expected ErrPoolExhausted, got %v", err)
+	}
+}
+
+func TestPoolRecyclesUnhealthy(t *testing.T) {
+	dials := 0
+	var bad *Client
+	p := NewPool(PoolConfig{
+		Dial: stubDialer(&dials),
+		Size: 1,
+		HealthCheck: func(c *Client) error {
+			if c == bad {
+				return errors.New("dead")
+			}
+			return nil
+		},
+	})
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad = c
+	p.Put(c)
+
+	c2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c {
+		t.Fatal("Expected unhealthy client to be replaced")
+	}
+	if dials != 2 {
+		t.Fatalf("Expected 2 dials, got %v", dials)
+	}
+}
+
+func TestPoolCloseTwice(t *testing.T) {
+	dials := 0
+	p := NewPool(PoolConfig{Dial: stubDialer(&dials), Size: 1})
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(c)
+	p.Close()
+	p.Close()
+	if _, err = p.Get(context.Background()); err != ErrPoolClosed {
+		t.Fatalf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolPutRacingClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		dials := 0
+		p := NewPool(PoolConfig{Dial: stubDialer(&dials), Size: 1})
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			p.Put(c)
+			close(done)
+		}()
+		p.Close()
+		<-done
+		if n := len(p.idle); n != 0 {
+			t.Fatalf("Expected no idle clients after Close, got %v", n)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package nntpclient
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrBadRange is returned by ParseRange for a malformed or reversed
+// range.
+var ErrBadRange = errors.New("invalid article range")
+
+// A Range of article numbers, inclusive at both ends.  A negative High
+// means the range is open-ended.
+type Range struct {
+	Low, High int64
+}
+
+// ParseRange parses a range in the forms used by commands such as OVER
+// and LISTGROUP: "n", "n-" or "n-m".
+func ParseRange(s string) (Range, error) {
+	lo, hi, dash := strings.Cut(s, "-")
+	low, err := strconv.ParseInt(lo, 10, 64)
+	if err != nil || low < 0 {
+		return Range{}, ErrBadRange
+	}
+	r := Range{low, low}
+	switch {
+	case !dash:
+	case hi == "":
+		r.High = -1
+	default:
+		r.High, err = strconv.ParseInt(hi, 10, 64)
+		if err != nil || r.High < low {
+			return Range{}, ErrBadRange
+		}
+	}
+	return r, nil
+}
+
+// Open reports whether the range has no upper bound.
+func (r Range) Open() bool {
+	return r.High < 0
+}
+
+// String formats the range as it's sent to the server.
+func (r Range) String() string {
+	low := strconv.FormatInt(r.Low, 10)
+	switch {
+	case r.Open():
+		return low + "-"
+	case r.High == r.Low:
+		return low
+	}
+	return low + "-" + strconv.FormatInt(r.High, 10)
+}
+
+// Chunks splits the range into consecutive ranges of at most size
+// articles each.  An open-ended range can't be split and is returned
+// whole, as is any range if size is less than 1.
+func (r Range) Chunks(size int64) []Range {
+	if r.Open() || size < 1 {
+		return []Range{r}
+	}
+	var rv []Range
+	for low := r.Low; low <= r.High; low += size {
+		high := low + size - 1
+		if high > r.High || high < low {
+			high = r.High
+		}
+		rv = append(rv, Range{low, high})
+		if high == r.High {
+			break
+		}
+	}
+	return rv
+}
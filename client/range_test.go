@@ -0,0 +1,65 @@
+package nntpclient
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Range
+		str  string
+	}{
+		{"3000238-3000248", Range{3000238, 3000248}, "3000238-3000248"},
+		{"3000238-", Range{3000238, -1}, "3000238-"},
+		{"42", Range{42, 42}, "42"},
+	}
+	for _, test := range tests {
+		r, err := ParseRange(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if r != test.want {
+			t.Errorf("%q: expected %v, got %v", test.in, test.want, r)
+		}
+		if r.String() != test.str {
+			t.Errorf("%q: expected string %q, got %q", test.in, test.str, r.String())
+		}
+	}
+
+	for _, bad := range []string{"", "-5", "10-5", "x-10", "10-x"} {
+		if _, err := ParseRange(bad); err != ErrBadRange {
+			t.Errorf("%q: expected ErrBadRange, got %v", bad, err)
+		}
+	}
+}
+
+func TestRangeChunks(t *testing.T) {
+	got := Range{1, 10}.Chunks(4)
+	want := []Range{{1, 4}, {5, 8}, {9, 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	got = Range{5, 5}.Chunks(100)
+	if !reflect.DeepEqual(got, []Range{{5, 5}}) {
+		t.Errorf("Got %v", got)
+	}
+
+	open := Range{5, -1}
+	if got := open.Chunks(2); !reflect.DeepEqual(got, []Range{open}) {
+		t.Errorf("Expected open range unsplit, got %v", got)
+	}
+}
+
+func TestRangeChunksNearMaxInt64(t *testing.T) {
+	r := Range{math.MaxInt64 - 4, math.MaxInt64}
+	got := r.Chunks(3)
+	want := []Range{{math.MaxInt64 - 4, math.MaxInt64 - 2}, {math.MaxInt64 - 1, math.MaxInt64}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
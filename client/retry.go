@@ -0,0 +1,98 @@
+package nntpclient
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoReconnect is returned when a client needs to reconnect but
+// wasn't created with a way to dial (for example, via NewConn).
+var ErrNoReconnect = errors.New("client can't reconnect")
+
+// RetryPolicy controls how WithRetry retries a failing operation.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first.
+	MaxAttempts int
+	// Backoff is the wait before the first retry.  It doubles after
+	// each attempt, up to MaxBackoff if that's set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// reconnect replaces the client's connection with a new one, then
+// sets the session up again with restoreSession.  Compression and the
+// current article are lost.
+func (c *Client) reconnect() error {
+	if c.dial == nil {
+		return ErrNoReconnect
+	}
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	fresh, err := connect(conn, c.config)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	wasTLS := c.IsTLS()
+	c.rwc.Close()
+	c.connection = fresh.connection
+	c.Banner, c.PostingAllowed = fresh.Banner, fresh.PostingAllowed
+	return c.restoreSession(wasTLS)
+}
+
+// restoreSession repeats, on a new connection, the STARTTLS,
+// authentication and group selection done on the old one.  The
+// password is never sent over a plain connection when the old one
+// used TLS; the credentials are dropped instead.
+func (c *Client) restoreSession(wasTLS bool) error {
+	if c.tlsConfig != nil {
+		if err := c.StartTLS(c.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if c.user != "" {
+		if wasTLS && !c.IsTLS() {
+			c.user, c.pass = "", ""
+		} else if _, err := c.Authenticate(c.user, c.pass); err != nil {
+			return err
+		}
+	}
+	if c.group != "" {
+		if _, err := c.Group(c.group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithRetry runs op, retrying it according to policy while it fails
+// with a transient error (see IsTransient).
+//
+// Between attempts after a connection error the client reconnects,
+// redoing STARTTLS, authentication (with AutoReauth) and GROUP.
+// Any other session setup op depends on must be redone by op.
+// Permanent errors, such as 411 or 430, are returned immediately.
+func (c *Client) WithRetry(policy RetryPolicy, op func(*Client) error) error {
+	wait := policy.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op(c)
+		if err == nil || !IsTransient(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+		if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+
+		if IsConnectionError(err) {
+			if rerr := c.reconnect(); rerr != nil {
+				return rerr
+			}
+		}
+	}
+}
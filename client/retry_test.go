@@ -0,0 +1,119 @@
+package nntpclient
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+func TestWithRetryTransient(t *testing.T) {
+	cli, err := NewConn(NewStub(200, "Stub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err = cli.WithRetry(testPolicy, func(c *Client) error {
+		attempts++
+		if attempts < 2 {
+			return &Error{503, "try again later"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("Expected 2 attempts, got %v", attempts)
+	}
+}
+
+func TestWithRetryPermanent(t *testing.T) {
+	cli, err := NewConn(NewStub(200, "Stub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err = cli.WithRetry(testPolicy, func(c *Client) error {
+		attempts++
+		return &Error{430, "No such article"}
+	})
+	if !errors.Is(err, &Error{Code: 430}) {
+		t.Fatalf("Expected the 430, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("Expected 1 attempt, got %v", attempts)
+	}
+}
+
+func TestWithRetryReconnects(t *testing.T) {
+	cli, err := NewConn(NewStub(200, "First"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.dial = func() (io.ReadWriteCloser, error) {
+		return NewStub(200, "Second"), nil
+	}
+
+	var banners []string
+	err = cli.WithRetry(testPolicy, func(c *Client) error {
+		banners = append(banners, c.Banner)
+		if len(banners) == 1 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banners) != 2 || banners[1] != "Second" {
+		t.Fatalf("Expected a reconnect between attempts, got %v", banners)
+	}
+
+	// Without a dialer, connection errors can't be retried.
+	cli, err = NewConn(NewStub(200, "Stub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cli.WithRetry(testPolicy, func(c *Client) error {
+		return io.ErrUnexpectedEOF
+	})
+	if err != ErrNoReconnect {
+		t.Fatalf("Expected ErrNoReconnect, got %v", err)
+	}
+}
+
+func TestReconnectRestoresSession(t *testing.T) {
+	cli, err := NewConnWithConfig(NewStub(200, "First"), Config{AutoReauth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.user, cli.pass, cli.group = "user", "pass", "misc.test"
+	cli.compressed = true
+	var stub *stubReaderWriter
+	cli.dial = func() (io.ReadWriteCloser, error) {
+		stub = NewStub(200, "Second")
+		stub.PrepareResponse("authinfo", 381, "Password required")
+		stub.PrepareResponse("authinfo", 281, "Authentication accepted")
+		stub.PrepareDotPayloadResponse("CAPABILITIES", 101, "Capability list:",
+			"VERSION 2", "READER")
+		stub.PrepareResponse("GROUP", 211, "3 1 3 misc.test")
+		return stub, nil
+	}
+
+	if err = cli.reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	lines := "authinfo user user|authinfo pass pass|CAPABILITIES|GROUP misc.test"
+	if got := strings.Join(stub.receivedLines, "|"); got != lines {
+		t.Errorf("Expected %q, got %q", lines, got)
+	}
+	if cli.Banner != "Second" || cli.compressed || cli.group != "misc.test" {
+		t.Errorf("Unexpected state after reconnect: %q %v %q", cli.Banner, cli.compressed, cli.group)
+	}
+}
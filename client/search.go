@@ -0,0 +1,139 @@
+package nntpclient
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knothon/go-nntp"
+)
+
+// wildmatRegexp compiles an XPAT style pattern, where * matches any run
+// of characters, ? any one character and [...] a set ([^...] a negated
+// one), into an anchored regular expression.
+func wildmatRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			class, end := wildmatSet(pattern[i+1:])
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString(class)
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// wildmatSet translates the set starting just after a [ into a
+// character class, returning it and the index of the closing ].  A ]
+// straight after the [ or [^ is a member, as is a - at either end, and
+// nothing else is special, so [\] matches a backslash and [[:alpha:]]
+// is a set of [, :, a, l, p and h followed by a ].  end is -1 if the
+// set isn't closed.
+func wildmatSet(s string) (class string, end int) {
+	var b strings.Builder
+	b.WriteString("[")
+	i := 0
+	if i < len(s) && s[i] == '^' {
+		b.WriteString("^")
+		i++
+	}
+	first := true
+	for i < len(s) {
+		if s[i] == ']' && !first {
+			b.WriteString("]")
+			return b.String(), i
+		}
+		first = false
+		lo, n := utf8.DecodeRuneInString(s[i:])
+		i += n
+		b.WriteString(classMember(lo))
+		if i+1 < len(s) && s[i] == '-' && s[i+1] != ']' {
+			hi, n := utf8.DecodeRuneInString(s[i+1:])
+			i += 1 + n
+			b.WriteString("-" + classMember(hi))
+		}
+	}
+	return "", -1
+}
+
+// classMember quotes r for use inside a regexp character class.
+func classMember(r rune) string {
+	switch r {
+	case '\\', '[', ']', '^', '-':
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+// SearchOverview selects a group and returns the overviews of the
+// articles in r whose subject matches an XPAT style pattern (such as
+// "*linux*").  XPAT takes whitespace as separating alternative
+// patterns, so spaces and tabs in the pattern match any one character.
+//
+// The search is done by the server with XPAT when it's available, so
+// only the matching overviews are transferred.  Otherwise the range's
+// overview is streamed and filtered here, which gives the same result
+// at the cost of fetching all of it.
+func (c *Client) SearchOverview(group string, r Range, subjectPattern string) ([]*nntp.ArticleOverview, error) {
+	if _, err := c.Group(group); err != nil {
+		return nil, err
+	}
+	subjectPattern = xpatPattern(subjectPattern)
+	numbers, err := c.xpat("Subject", r, subjectPattern)
+	if err == nil {
+		if len(numbers) == 0 {
+			return []*nntp.ArticleOverview{}, nil
+		}
+		return c.OverNumbers(numbers)
+	}
+	if !IsUnsupported(err) {
+		return nil, err
+	}
+
+	re, err := wildmatRegexp(subjectPattern)
+	if err != nil {
+		return nil, err
+	}
+	rv := []*nntp.ArticleOverview{}
+	err = c.OverStream(r, func(o *nntp.ArticleOverview) error {
+		if re.MatchString(o.SubjectClean()) {
+			rv = append(rv, o)
+		}
+		return nil
+	})
+	return rv, err
+}
+
+// xpatPattern makes a pattern safe to send as a single XPAT argument
+// by turning whitespace into ?.
+func xpatPattern(pattern string) string {
+	return strings.NewReplacer(" ", "?", "\t", "?").Replace(pattern)
+}
+
+// xpat returns the numbers of the articles in r whose header matches
+// pattern, using XPAT (RFC 2980).
+func (c *Client) xpat(header string, r Range, pattern string) ([]int64, error) {
+	rv := []int64{}
+	err := c.hdrCommand("XPAT "+header+" "+r.String()+" "+pattern, 221, func(n int64, _ string) {
+		rv = append(rv, n)
+	})
+	return rv, err
+}
@@ -0,0 +1,141 @@
+package nntpclient
+
+import (
+	"testing"
+)
+
+func searchStub() *stubReaderWriter {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("GROUP", 211, "3 1 3 misc.test")
+	stub.PrepareDotPayloadResponse("LIST", 215, "List Format:", "Subject:",
+		"From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines")
+	return stub
+}
+
+func TestSearchOverviewXpat(t *testing.T) {
+	stub := searchStub()
+	stub.PrepareDotPayloadResponse("XPAT", 221, "Header follows",
+		"1 Linux news", "3 Re: Linux news")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"1\tLinux news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"3\tRe: Linux news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<3@x>\t\t10\t1")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, err := cli.SearchOverview("misc.test", Range{1, 3}, "*Linux*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 2 || rv[0].Id != 1 || rv[1].Id != 3 {
+		t.Errorf("Expected articles 1 and 3, got %v", rv)
+	}
+	if !HasReceivedLine(stub, "XPAT Subject 1-3 *Linux*") {
+		t.Errorf("Expected XPAT, got %q", stub.receivedLines)
+	}
+	if HasReceivedLine(stub, "OVER 1-3") {
+		t.Error("Expected only the matches to be fetched")
+	}
+}
+
+func TestSearchOverviewFallback(t *testing.T) {
+	stub := searchStub()
+	stub.PrepareResponse("XPAT", 500, "What?")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:",
+		"1\tLinux news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1",
+		"2\tBSD news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1",
+		"3\tRe: Linux news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<3@x>\t\t10\t1")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv, err := cli.SearchOverview("misc.test", Range{1, 3}, "*Linux*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 2 || rv[0].Id != 1 || rv[1].Id != 3 {
+		t.Errorf("Expected articles 1 and 3, got %v", rv)
+	}
+}
+
+func TestSearchOverviewSpaces(t *testing.T) {
+	overviews := []string{
+		"1\tlinux kernel news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<1@x>\t\t10\t1",
+		"2\tlinux news\ta@x\tTue, 28 Nov 2017 20:09:05 GMT\t<2@x>\t\t10\t1",
+	}
+
+	stub := searchStub()
+	stub.PrepareDotPayloadResponse("XPAT", 221, "Header follows", "1 linux kernel news")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:", overviews[0])
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := cli.SearchOverview("misc.test", Range{1, 2}, "*linux kernel*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 1 || rv[0].Id != 1 {
+		t.Errorf("XPAT: expected article 1, got %v", rv)
+	}
+	if !HasReceivedLine(stub, "XPAT Subject 1-2 *linux?kernel*") {
+		t.Errorf("Expected the space sent as ?, got %q", stub.receivedLines)
+	}
+
+	stub = searchStub()
+	stub.PrepareResponse("XPAT", 500, "What?")
+	stub.PrepareDotPayloadResponse("OVER", 224, "Overview:", overviews...)
+	if cli, err = NewConn(stub); err != nil {
+		t.Fatal(err)
+	}
+	rv, err = cli.SearchOverview("misc.test", Range{1, 2}, "*linux kernel*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rv) != 1 || rv[0].Id != 1 {
+		t.Errorf("Fallback: expected article 1, got %v", rv)
+	}
+}
+
+func TestWildmatRegexp(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*linux*", "all about linux here", true},
+		{"*linux*", "all about Linux", false},
+		{"part ?", "part 1", true},
+		{"part ?", "part 12", false},
+		{"[Rr]e: *", "re: hello", true},
+		{"a.b", "axb", false},
+		{`\*star`, "*star", true},
+		{"[^Rr]e: *", "re: hello", false},
+		{"[^Rr]e: *", "Fe: hello", true},
+		{"[[:alpha:]]", "x", false},
+		{"[[:alpha:]]", "p]", true},
+		{"[[:alpha:]]", "[]", true},
+		{`[\]`, `\`, true},
+		{`[\]`, "]", false},
+		{"[]a]", "]", true},
+		{"[]a]", "a", true},
+		{"[^]a]", "]", false},
+		{"[^]a]", "b", true},
+		{"[a-c-]", "-", true},
+		{"[a-c-]", "b", true},
+		{"[-a]", "-", true},
+		{"[ab", "[ab", true},
+	}
+	for _, test := range tests {
+		re, err := wildmatRegexp(test.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+		if got := re.MatchString(test.s); got != test.match {
+			t.Errorf("%q against %q: expected %v", test.pattern, test.s, test.match)
+		}
+	}
+}
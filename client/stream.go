@@ -0,0 +1,305 @@
+package nntpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/knothon/go-nntp"
+)
+
+// ModeStream switches the session to streaming mode (RFC 4644), which
+// enables CHECK and TAKETHIS.
+func (c *Client) ModeStream() error {
+	_, _, err := c.Command("MODE STREAM", 203)
+	return err
+}
+
+// A FeedError is a server's refusal of an article offered with IHAVE,
+// CHECK or TAKETHIS.
+type FeedError struct {
+	MessageID string
+	Code      int
+	Msg       string
+}
+
+func (e *FeedError) Error() string {
+	return fmt.Sprintf("%s: %03d %s", e.MessageID, e.Code, e.Msg)
+}
+
+// Unwrap returns the response as an *Error.
+func (e *FeedError) Unwrap() error {
+	return &Error{Code: e.Code, Msg: e.Msg}
+}
+
+// Reason returns the server's diagnostic text, such as "duplicate" or
+// "bad message-id", without the message-id that servers like INN put
+// in front of it.
+func (e *FeedError) Reason() string {
+	msg := strings.TrimSpace(e.Msg)
+	if f := strings.Fields(msg); len(f) > 0 && f[0] == e.MessageID {
+		msg = strings.TrimSpace(msg[len(f[0]):])
+	}
+	return msg
+}
+
+// Retryable reports whether the article may be offered again later
+// (431 or 436), as opposed to being unwanted or rejected for good
+// (435, 437, 438 or 439).
+func (e *FeedError) Retryable() bool {
+	return e.Code == 431 || e.Code == 436
+}
+
+// feedResponse reads the response to a feed command for id, turning a
+// 4xx refusal into a *FeedError.
+func (c *Client) feedResponse(id string, expect int) error {
+	_, _, err := readCodeLine(c.conn, expect)
+	return feedError(id, err)
+}
+
+// feedError turns a 4xx refusal of the article id into a *FeedError.
+func feedError(id string, err error) error {
+	var e *Error
+	if errors.As(err, &e) && e.Code >= 430 && e.Code < 440 {
+		return &FeedError{MessageID: id, Code: e.Code, Msg: e.Msg}
+	}
+	return err
+}
+
+// IHave offers an article to the server with IHAVE, sending it if it's
+// wanted.  A refusal is returned as a *FeedError.
+func (c *Client) IHave(a *nntp.Article) error {
+	id := a.MessageID()
+	if _, _, err := c.Command("IHAVE "+id, 335); err != nil {
+		return feedError(id, err)
+	}
+	dw := c.conn.DotWriter()
+	if err := writeArticle(dw, a); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return err
+	}
+	return c.feedResponse(id, 235)
+}
+
+// TakeThis sends an article with TAKETHIS, which requires streaming
+// mode (see ModeStream).  A refusal is returned as a *FeedError.
+func (c *Client) TakeThis(a *nntp.Article) error {
+	id := a.MessageID()
+	if err := c.queueCommand("TAKETHIS %s", id); err != nil {
+		return err
+	}
+	dw := c.conn.DotWriter()
+	if err := writeArticle(dw, a); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return err
+	}
+	return c.feedResponse(id, 239)
+}
+
+// StreamStatus is the outcome of offering one article while streaming.
+type StreamStatus int
+
+// StreamStatus values.
+const (
+	// The article wasn't offered (the batch stopped first).
+	StreamPending = StreamStatus(iota)
+	// The server took the article (239).
+	StreamSent
+	// The server didn't want the article (438).
+	StreamNotWanted
+	// The server rejected the article after it was sent (439).
+	StreamRejected
+	// The server kept asking to try later (431).
+	StreamDeferred
+	// Something else went wrong; see the result's Err.
+	StreamFailed
+)
+
+// A StreamResult reports what happened to one article in an upload.
+type StreamResult struct {
+	MessageID string
+	Status    StreamStatus
+	Err       error
+}
+
+// StreamResults are in the same order as the uploaded articles.
+type StreamResults []StreamResult
+
+// A StreamUploader feeds articles with pipelined CHECK and TAKETHIS
+// commands.
+type StreamUploader struct {
+	c *Client
+	// Window is the number of commands sent before reading their
+	// responses.
+	Window int
+	// MaxDefers is how many times an article deferred with 431 is
+	// offered again before giving up on it.
+	MaxDefers int
+}
+
+// NewStreamUploader puts the client into streaming mode and returns an
+// uploader keeping up to window commands in flight.
+func NewStreamUploader(c *Client, window int) (*StreamUploader, error) {
+	if err := c.ModeStream(); err != nil {
+		return nil, err
+	}
+	if window < 1 {
+		window = 1
+	}
+	return &StreamUploader{c: c, Window: window, MaxDefers: 3}, nil
+}
+
+// writeArticle writes an article's headers and body.
+//
+// An Article's Header is a map, so the order the headers arrived in is
+// already gone by the time it gets here.  They're written sorted by
+// name to keep the output stable; RFC 5536 gives header order no
+// meaning.
+func writeArticle(w io.Writer, a *nntp.Article) error {
+	keys := make([]string, 0, len(a.Header))
+	for k := range a.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range a.Header[k] {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+	if a.Body == nil {
+		return nil
+	}
+	_, err := io.Copy(w, a.Body)
+	return err
+}
+
+// readStreamResponse reads the response to a CHECK or TAKETHIS for id.
+func (u *StreamUploader) readStreamResponse(id string) (int, string, error) {
+	code, msg, err := readCodeLine(u.c.conn, -1)
+	if err != nil {
+		return 0, "", err
+	}
+	if got := responseMessageID(msg); got != "" && got != id {
+		return 0, "", fmt.Errorf("stream response for %s while expecting %s", got, id)
+	}
+	return code, msg, nil
+}
+
+// Upload offers the articles to the server, sending the wanted ones.
+//
+// Each window of articles is first offered with CHECK.  Wanted
+// articles are then sent with TAKETHIS, and deferred ones requeued
+// behind the rest, up to MaxDefers times.  An article deferred after
+// it was sent is left StreamDeferred, since its body has been read and
+// must be supplied again by the caller.  Per-article outcomes are in
+// the results.  A non-nil error means the connection failed and the
+// articles not yet handled are left StreamPending.
+func (u *StreamUploader) Upload(articles []*nntp.Article) (StreamResults, error) {
+	rv := make(StreamResults, len(articles))
+	defers := make([]int, len(articles))
+	queue := make([]int, 0, len(articles))
+	seen := u.c.newBatchIDs()
+	for i, a := range articles {
+		rv[i].MessageID = a.MessageID()
+		if err := seen.check(rv[i].MessageID); err != nil {
+			rv[i].Status = StreamFailed
+			rv[i].Err = err
+			continue
+		}
+		queue = append(queue, i)
+	}
+
+	for len(queue) > 0 {
+		n := u.Window
+		if n > len(queue) {
+			n = len(queue)
+		}
+		batch := queue[:n]
+		queue = queue[n:]
+
+		for _, i := range batch {
+			if err := u.c.queueCommand("CHECK %s", rv[i].MessageID); err != nil {
+				return rv, err
+			}
+		}
+		if err := u.c.Flush(); err != nil {
+			return rv, err
+		}
+		var wanted []int
+		for _, i := range batch {
+			code, msg, err := u.readStreamResponse(rv[i].MessageID)
+			if err != nil {
+				return rv, err
+			}
+			switch code {
+			case 238:
+				wanted = append(wanted, i)
+			case 438:
+				rv[i].Status = StreamNotWanted
+			case 431:
+				queue = u.deferred(rv, defers, queue, i)
+			default:
+				rv[i].Status = StreamFailed
+				rv[i].Err = &Error{Code: code, Msg: msg}
+			}
+		}
+
+		for _, i := range wanted {
+			if err := u.c.queueCommand("TAKETHIS %s", rv[i].MessageID); err != nil {
+				return rv, err
+			}
+			dw := u.c.conn.DotWriter()
+			if err := writeArticle(dw, articles[i]); err != nil {
+				return rv, err
+			}
+			if err := dw.Close(); err != nil {
+				return rv, err
+			}
+		}
+		for _, i := range wanted {
+			code, msg, err := u.readStreamResponse(rv[i].MessageID)
+			if err != nil {
+				return rv, err
+			}
+			switch code {
+			case 239:
+				rv[i].Status = StreamSent
+			case 439:
+				rv[i].Status = StreamRejected
+				rv[i].Err = &FeedError{MessageID: rv[i].MessageID, Code: code, Msg: msg}
+			case 431:
+				// Not a valid TAKETHIS response (RFC 4644), and
+				// the body has already been read, so it can't be
+				// resent from here.
+				rv[i].Status = StreamDeferred
+				rv[i].Err = &FeedError{MessageID: rv[i].MessageID, Code: code, Msg: msg}
+			default:
+				rv[i].Status = StreamFailed
+				rv[i].Err = &Error{Code: code, Msg: msg}
+			}
+		}
+	}
+	return rv, nil
+}
+
+// deferred requeues article i, or marks it StreamDeferred once it's
+// been deferred too often.
+func (u *StreamUploader) deferred(rv StreamResults, defers []int, queue []int, i int) []int {
+	defers[i]++
+	if defers[i] > u.MaxDefers {
+		rv[i].Status = StreamDeferred
+		return queue
+	}
+	return append(queue, i)
+}
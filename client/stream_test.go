@@ -0,0 +1,262 @@
+package nntpclient
+
+import (
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/knothon/go-nntp"
+)
+
+func streamArticle(id string) *nntp.Article {
+	return &nntp.Article{
+		Header: textproto.MIMEHeader{
+			"Message-Id": {id},
+			"Newsgroups": {"misc.test"},
+		},
+		Body: strings.NewReader("body of " + id + "\r\n"),
+	}
+}
+
+func TestStreamUploaderWindow(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 203, "Streaming permitted")
+	// First window: a wanted, b deferred.  Second: c not wanted, d
+	// rejected after sending.  Third: the requeued b is wanted.
+	stub.PrepareResponse("CHECK", 238, "<a@x>")
+	stub.PrepareResponse("CHECK", 431, "<b@x>")
+	stub.PrepareResponse("CHECK", 438, "<c@x>")
+	stub.PrepareResponse("CHECK", 238, "<d@x>")
+	stub.PrepareResponse("CHECK", 238, "<b@x>")
+	stub.PrepareResponse("TAKETHIS", 239, "<a@x>")
+	stub.PrepareResponse("TAKETHIS", 439, "<d@x>")
+	stub.PrepareResponse("TAKETHIS", 239, "<b@x>")
+
+	c, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewStreamUploader(c, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := u.Upload([]*nntp.Article{
+		streamArticle("<a@x>"), streamArticle("<b@x>"),
+		streamArticle("<c@x>"), streamArticle("<d@x>"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []StreamStatus{StreamSent, StreamSent, StreamNotWanted, StreamRejected}
+	for i, r := range rv {
+		if r.Status != want[i] {
+			t.Errorf("Article %v (%v): expected status %v, got %v",
+				i, r.MessageID, want[i], r.Status)
+		}
+	}
+
+	lines := []string{"MODE STREAM",
+		"CHECK <a@x>", "CHECK <b@x>", "TAKETHIS <a@x>",
+		"CHECK <c@x>", "CHECK <d@x>", "TAKETHIS <d@x>",
+		"CHECK <b@x>", "TAKETHIS <b@x>"}
+	if strings.Join(stub.receivedLines, "|") != strings.Join(lines, "|") {
+		t.Errorf("Expected commands %q, got %q", lines, stub.receivedLines)
+	}
+	if len(stub.receivedArticles) != 3 ||
+		!strings.Contains(stub.receivedArticles[0], "body of <a@x>") {
+		t.Errorf("Unexpected articles sent: %q", stub.receivedArticles)
+	}
+}
+
+func TestStreamUploaderGivesUpDeferring(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 203, "Streaming permitted")
+	stub.PrepareResponse("CHECK", 431, "<a@x>")
+
+	c, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewStreamUploader(c, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.MaxDefers = 2
+	rv, err := u.Upload([]*nntp.Article{streamArticle("<a@x>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv[0].Status != StreamDeferred {
+		t.Errorf("Expected StreamDeferred, got %v", rv[0].Status)
+	}
+	if n := CountReceivedRequests(stub, "CHECK"); n != 3 {
+		t.Errorf("Expected 3 CHECKs, got %v", n)
+	}
+}
+
+func TestFeedErrorRetryable(t *testing.T) {
+	tests := []struct {
+		cmd       string
+		code      int
+		retryable bool
+	}{
+		{"IHAVE", 435, false},
+		{"IHAVE", 436, true},
+		{"IHAVE", 437, false},
+		{"TAKETHIS", 439, false},
+	}
+	for _, test := range tests {
+		stub := NewStub(200, "Stub")
+		stub.PrepareResponse(test.cmd, test.code, "<a@x> no")
+		cli, err := NewConn(stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.cmd == "IHAVE" {
+			err = cli.IHave(streamArticle("<a@x>"))
+		} else {
+			err = cli.TakeThis(streamArticle("<a@x>"))
+		}
+		var fe *FeedError
+		if !errors.As(err, &fe) {
+			t.Errorf("%v %v: expected a FeedError, got %v", test.cmd, test.code, err)
+			continue
+		}
+		if fe.Code != test.code || fe.MessageID != "<a@x>" || fe.Retryable() != test.retryable {
+			t.Errorf("%v %v: got %#v, retryable %v", test.cmd, test.code, fe, fe.Retryable())
+		}
+	}
+}
+
+func TestIHaveRejectedAfterSending(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("IHAVE", 335, "Send it")
+	stub.PrepareResponse("IHAVE", 436, "Transfer failed, try again later")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.IHave(streamArticle("<a@x>"))
+	var fe *FeedError
+	if !errors.As(err, &fe) || !fe.Retryable() {
+		t.Fatalf("Expected a retryable FeedError, got %v", err)
+	}
+	if len(stub.receivedArticles) != 1 {
+		t.Errorf("Expected the article to be sent, got %q", stub.receivedArticles)
+	}
+}
+
+func TestIHaveAccepted(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("IHAVE", 335, "Send it")
+	stub.PrepareResponse("IHAVE", 235, "Article transferred OK")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.IHave(streamArticle("<a@x>")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTakeThisRejectionReason(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("TAKETHIS", 439, "<a@x> duplicate")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.TakeThis(streamArticle("<a@x>"))
+	var fe *FeedError
+	if !errors.As(err, &fe) {
+		t.Fatalf("Expected a FeedError, got %v", err)
+	}
+	if fe.Code != 439 || fe.Reason() != "duplicate" {
+		t.Errorf("Expected 439 duplicate, got %v %q", fe.Code, fe.Reason())
+	}
+	if !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected the reason in %q", err)
+	}
+}
+
+func TestStreamUploaderRejectionReason(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 203, "Streaming permitted")
+	stub.PrepareResponse("CHECK", 238, "<a@x>")
+	stub.PrepareResponse("TAKETHIS", 439, "<a@x> bad message-id")
+	c, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewStreamUploader(c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := u.Upload([]*nntp.Article{streamArticle("<a@x>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fe *FeedError
+	if !errors.As(rv[0].Err, &fe) || fe.Reason() != "bad message-id" {
+		t.Errorf("Expected the rejection reason, got %v", rv[0].Err)
+	}
+}
+
+func TestStreamUploaderDuplicateMessageID(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 203, "Streaming permitted")
+	stub.PrepareResponse("CHECK", 238, "<a@x>")
+	stub.PrepareResponse("TAKETHIS", 239, "<a@x>")
+	c, err := NewConnWithConfig(stub, Config{DetectDuplicateIDs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewStreamUploader(c, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := u.Upload([]*nntp.Article{streamArticle("<a@x>"), streamArticle("<a@x>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv[0].Status != StreamSent {
+		t.Errorf("Expected the first to be sent, got %v", rv[0].Status)
+	}
+	if rv[1].Status != StreamFailed || !errors.Is(rv[1].Err, ErrDuplicateMessageID) {
+		t.Errorf("Expected the second refused as a duplicate, got %v %v", rv[1].Status, rv[1].Err)
+	}
+	if n := CountReceivedRequests(stub, "CHECK"); n != 1 {
+		t.Errorf("Expected one CHECK, got %v", n)
+	}
+}
+
+func TestStreamUploaderTakeThisDeferredNotResent(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("MODE", 203, "Streaming permitted")
+	stub.PrepareResponse("CHECK", 238, "<a@x>")
+	stub.PrepareResponse("TAKETHIS", 431, "<a@x>")
+	c, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewStreamUploader(c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv, err := u.Upload([]*nntp.Article{streamArticle("<a@x>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fe *FeedError
+	if rv[0].Status != StreamDeferred || !errors.As(rv[0].Err, &fe) || !fe.Retryable() {
+		t.Errorf("Expected a retryable StreamDeferred, got %v %v", rv[0].Status, rv[0].Err)
+	}
+	if len(stub.receivedArticles) != 1 ||
+		!strings.Contains(stub.receivedArticles[0], "body of <a@x>") {
+		t.Errorf("Expected the article sent once with its body, got %q", stub.receivedArticles)
+	}
+}
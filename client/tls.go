@@ -0,0 +1,85 @@
+package nntpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrTLSActive is returned by StartTLS on a connection that's already
+// encrypted.
+var ErrTLSActive = errors.New("TLS already active")
+
+// ErrNotTLS is returned by CertificateExpiry on a connection that
+// isn't encrypted.
+var ErrNotTLS = errors.New("connection not using TLS")
+
+// StartTLS upgrades the connection to TLS with STARTTLS (RFC 4642).
+//
+// It must be used before compression is enabled, and the connection
+// must be a net.Conn.  As the RFC requires, the cached capabilities
+// are discarded, since the server may advertise different ones once
+// encrypted.  A reconnect (see WithRetry) repeats STARTTLS with the
+// same config before anything else is sent.  If the handshake fails
+// the client is closed.
+func (c *Client) StartTLS(config *tls.Config) error {
+	if c.IsTLS() {
+		return ErrTLSActive
+	}
+	if c.compressed {
+		return ErrCompressionActive
+	}
+	nc, ok := c.rwc.(net.Conn)
+	if !ok {
+		return errors.New("STARTTLS needs a net.Conn")
+	}
+	if _, _, err := c.Command("STARTTLS", 382); err != nil {
+		return err
+	}
+	tc := tls.Client(nc, config)
+	if err := tc.Handshake(); err != nil {
+		// Part of a handshake may have been read or written, so
+		// the plain connection can't be trusted to be in step.
+		c.Close()
+		return err
+	}
+	c.rwc = tc
+	c.conn = newTextprotoConn(tc, c.config)
+	c.tlsConfig = config
+	c.capabilities = nil
+	c.loadedCapabilities = false
+	return nil
+}
+
+// IsTLS reports whether the connection is encrypted with TLS, whether
+// from NewSsl, a *tls.Conn given to NewConn or StartTLS.
+func (c *Client) IsTLS() bool {
+	_, ok := c.rwc.(*tls.Conn)
+	return ok
+}
+
+// ConnectionState returns the state of the TLS connection, for
+// inspecting the cipher suite or certificates.  ok is false if the
+// connection isn't using TLS.
+func (c *Client) ConnectionState() (state tls.ConnectionState, ok bool) {
+	tc, ok := c.rwc.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tc.ConnectionState(), true
+}
+
+// CertificateExpiry returns when the server's certificate expires, for
+// monitoring providers whose certificates are about to lapse.  It
+// returns ErrNotTLS for an unencrypted connection.
+func (c *Client) CertificateExpiry() (time.Time, error) {
+	state, ok := c.ConnectionState()
+	if !ok {
+		return time.Time{}, ErrNotTLS
+	}
+	if len(state.PeerCertificates) == 0 {
+		return time.Time{}, errors.New("server sent no certificate")
+	}
+	return state.PeerCertificates[0].NotAfter, nil
+}
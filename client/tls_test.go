@@ -0,0 +1,187 @@
+package nntpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate makes a self-signed certificate for news.example.com.
+func testCertificate(t *testing.T, notAfter time.Time) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "news.example.com"},
+		DNSNames:     []string{"news.example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSServer answers STARTTLS on a pipe, then DATE over TLS.
+func startTLSServer(t *testing.T, cert tls.Certificate) net.Conn {
+	cconn, sconn := net.Pipe()
+	go func() {
+		defer sconn.Close()
+		tp := textproto.NewConn(sconn)
+		tp.PrintfLine("200 hello")
+		if line, err := tp.ReadLine(); err != nil || line != "STARTTLS" {
+			return
+		}
+		tp.PrintfLine("382 Continue with TLS negotiation")
+		tc := tls.Server(sconn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		tp = textproto.NewConn(tc)
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			if line == "DATE" {
+				tp.PrintfLine("111 20190103185844")
+			} else if strings.HasPrefix(line, "authinfo user ") {
+				tp.PrintfLine("281 Authentication accepted")
+			} else {
+				tp.PrintfLine("500 what?")
+			}
+		}
+	}()
+	return cconn
+}
+
+func TestStartTLS(t *testing.T) {
+	conn := startTLSServer(t, testCertificate(t, time.Now().Add(time.Hour)))
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if cli.IsTLS() {
+		t.Fatal("Expected a plain connection before STARTTLS")
+	}
+	if _, ok := cli.ConnectionState(); ok {
+		t.Fatal("Expected no connection state before STARTTLS")
+	}
+	err = cli.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cli.IsTLS() {
+		t.Fatal("Expected TLS after STARTTLS")
+	}
+	state, ok := cli.ConnectionState()
+	if !ok || !state.HandshakeComplete || len(state.PeerCertificates) != 1 {
+		t.Fatalf("Unexpected connection state: %v %#v", ok, state)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.StartTLS(nil); err != ErrTLSActive {
+		t.Fatalf("Expected ErrTLSActive, got %v", err)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	expires := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+	conn := startTLSServer(t, testCertificate(t, expires))
+	cli, err := NewConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err = cli.CertificateExpiry(); err != ErrNotTLS {
+		t.Fatalf("Expected ErrNotTLS before STARTTLS, got %v", err)
+	}
+	if err = cli.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cli.CertificateExpiry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(expires) {
+		t.Errorf("Expected expiry %v, got %v", expires, got)
+	}
+}
+
+func TestReconnectRepeatsStartTLS(t *testing.T) {
+	cert := testCertificate(t, time.Now().Add(time.Hour))
+	cli, err := NewConnWithConfig(startTLSServer(t, cert), Config{AutoReauth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if err = cli.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatal(err)
+	}
+	cli.user, cli.pass = "user", "secret"
+	cli.dial = func() (io.ReadWriteCloser, error) {
+		return startTLSServer(t, cert), nil
+	}
+
+	if err = cli.reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !cli.IsTLS() || cli.user != "user" {
+		t.Fatalf("Expected TLS and credentials after reconnect, got %v %q", cli.IsTLS(), cli.user)
+	}
+	if _, _, err = cli.Command("DATE", 111); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dialer giving a plain connection mustn't get the password.
+	cli.tlsConfig = nil
+	cli.dial = func() (io.ReadWriteCloser, error) {
+		return NewStub(200, "Stub"), nil
+	}
+	if err = cli.reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if cli.user != "" || cli.pass != "" {
+		t.Errorf("Expected the credentials dropped on a plain connection")
+	}
+}
+
+func TestStartTLSHandshakeFails(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	go func() {
+		defer sconn.Close()
+		tp := textproto.NewConn(sconn)
+		tp.PrintfLine("200 hello")
+		tp.ReadLine()
+		tp.PrintfLine("382 Continue with TLS negotiation")
+		// Not a TLS server after all.
+		go io.Copy(io.Discard, sconn)
+		tp.PrintfLine("500 what?")
+	}()
+	cli, err := NewConn(cconn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cli.StartTLS(&tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Fatal("Expected the handshake to fail")
+	}
+	if _, err = cli.Date(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected the client to be closed, got %v", err)
+	}
+}
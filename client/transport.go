@@ -0,0 +1,26 @@
+package nntpclient
+
+import (
+	"io"
+	"time"
+)
+
+// A Transport carries an NNTP session over something other than a
+// plain network connection, such as a QUIC stream or a WebSocket.
+// The deadline is used to time out the server's greeting (see
+// Config.ConnectTimeout).
+type Transport interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// NewTransport starts a session over a custom transport.
+func NewTransport(t Transport) (*Client, error) {
+	return NewTransportWithConfig(t, Config{})
+}
+
+// NewTransportWithConfig starts a session over a custom transport with
+// the given settings.
+func NewTransportWithConfig(t Transport, cfg Config) (*Client, error) {
+	return connect(t, cfg)
+}
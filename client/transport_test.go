@@ -0,0 +1,41 @@
+package nntpclient
+
+import (
+	"testing"
+	"time"
+)
+
+// mockTransport runs the stub as a Transport, recording deadlines.
+type mockTransport struct {
+	*stubReaderWriter
+	deadlines []time.Time
+}
+
+func (m *mockTransport) SetDeadline(t time.Time) error {
+	m.deadlines = append(m.deadlines, t)
+	return nil
+}
+
+func TestTransport(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareResponse("DATE", 111, "20190103180000")
+	tr := &mockTransport{stubReaderWriter: stub}
+	cli, err := NewTransportWithConfig(tr, Config{ConnectTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.Banner != "Stub" {
+		t.Errorf("Expected banner Stub, got %q", cli.Banner)
+	}
+	if len(tr.deadlines) != 2 || tr.deadlines[0].IsZero() || !tr.deadlines[1].IsZero() {
+		t.Errorf("Expected the banner deadline set and cleared, got %v", tr.deadlines)
+	}
+
+	d, err := cli.Date()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal(time.Date(2019, 1, 3, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected date %v", d)
+	}
+}
@@ -0,0 +1,150 @@
+package nntpclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ErrBadYenc is returned when a yEnc encoded body can't be decoded.
+var ErrBadYenc = errors.New("malformed yEnc data")
+
+var yencBegin = []byte("=ybegin ")
+
+// yencReader decodes a single yEnc encoded (possibly multipart) body.
+type yencReader struct {
+	src     *bufio.Reader
+	pending []byte
+	err     error
+
+	name  string
+	size  int64
+	part  int
+	begin int64
+	end   int64
+}
+
+// yencParam finds a key=value parameter on a yEnc control line.  The
+// name parameter always runs to the end of the line.
+func yencParam(line []byte, key string) (string, bool) {
+	i := bytes.Index(line, []byte(" "+key+"="))
+	if i < 0 {
+		return "", false
+	}
+	v := line[i+len(key)+2:]
+	if key != "name" {
+		if j := bytes.IndexByte(v, ' '); j >= 0 {
+			v = v[:j]
+		}
+	}
+	return string(bytes.TrimRight(v, "\r\n")), true
+}
+
+func yencInt(line []byte, key string) int64 {
+	s, ok := yencParam(line, key)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// newYencReader reads the =ybegin (and optional =ypart) lines from src
+// and returns a reader of the decoded data.
+func newYencReader(src *bufio.Reader) (*yencReader, error) {
+	line, err := src.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	if !bytes.HasPrefix(line, yencBegin) {
+		return nil, ErrBadYenc
+	}
+	y := &yencReader{src: src}
+	y.name, _ = yencParam(line, "name")
+	y.size = yencInt(line, "size")
+	y.part = int(yencInt(line, "part"))
+
+	if y.part > 0 {
+		line, err = src.ReadBytes('\n')
+		if err != nil || !bytes.HasPrefix(line, []byte("=ypart ")) {
+			return nil, ErrBadYenc
+		}
+		y.begin = yencInt(line, "begin")
+		y.end = yencInt(line, "end")
+	}
+	return y, nil
+}
+
+func (y *yencReader) Read(p []byte) (int, error) {
+	for len(y.pending) == 0 {
+		if y.err != nil {
+			return 0, y.err
+		}
+		line, err := y.src.ReadBytes('\n')
+		if bytes.HasPrefix(line, []byte("=yend")) {
+			y.err = io.EOF
+			// Anything after the trailer isn't ours.
+			io.Copy(io.Discard, y.src)
+			continue
+		}
+		y.pending = yencDecode(y.pending[:0], line)
+		if err == io.EOF {
+			// The body ended without a trailer.
+			err = io.ErrUnexpectedEOF
+		}
+		y.err = err
+	}
+	n := copy(p, y.pending)
+	y.pending = y.pending[n:]
+	return n, nil
+}
+
+// yencDecode appends the decoded form of a single encoded line to dst.
+func yencDecode(dst, line []byte) []byte {
+	for i := 0; i < len(line); i++ {
+		b := line[i]
+		switch b {
+		case '\r', '\n':
+			continue
+		case '=':
+			i++
+			if i >= len(line) {
+				return dst
+			}
+			b = line[i] - 64
+		}
+		dst = append(dst, b-42)
+	}
+	return dst
+}
+
+// decodeBody wraps an article body, decoding it if it's yEnc encoded
+// and passing it through otherwise.
+func decodeBody(body io.Reader) (filename string, r io.Reader, err error) {
+	br := bufio.NewReader(body)
+	peek, err := br.Peek(len(yencBegin))
+	if err != nil || !bytes.Equal(peek, yencBegin) {
+		return "", br, nil
+	}
+	y, err := newYencReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	return y.name, y, nil
+}
+
+// ArticleDecoded fetches the body of an article and returns it with
+// any transfer encoding removed.
+//
+// yEnc bodies are detected and decoded, returning the encoded file
+// name.  Other bodies are returned as is with an empty name.  As with
+// Body, the reader must be consumed before issuing another command.
+func (c *Client) ArticleDecoded(specifier string) (filename string, r io.Reader, err error) {
+	_, _, body, err := c.Body(specifier)
+	if err != nil {
+		return "", nil, err
+	}
+	return decodeBody(body)
+}
@@ -0,0 +1,108 @@
+package nntpclient
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// yencEncode encodes data as yEnc lines of at most 128 encoded bytes.
+func yencEncode(data []byte) []string {
+	var lines []string
+	var line []byte
+	for _, b := range data {
+		e := b + 42
+		switch {
+		case e == 0, e == '\n', e == '\r', e == '=',
+			len(line) == 0 && (e == '.' || e == ' ' || e == '\t'):
+			line = append(line, '=', e+64)
+		default:
+			line = append(line, e)
+		}
+		if len(line) >= 128 {
+			lines = append(lines, string(line))
+			line = nil
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func yencPayload(name string, data []byte) []string {
+	lines := []string{"=ybegin line=128 size=" + strconv.Itoa(len(data)) + " name=" + name}
+	lines = append(lines, yencEncode(data)...)
+	return append(lines, "=yend size="+strconv.Itoa(len(data)))
+}
+
+func TestArticleDecodedYenc(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponseArray("BODY", 222, "1 <a@b> body",
+		yencPayload("my file.bin", data))
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, r, err := cli.ArticleDecoded("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "my file.bin" {
+		t.Fatalf("Expected name %q, got %q", "my file.bin", name)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Decoded data mismatch: got %d bytes", len(got))
+	}
+}
+
+func TestArticleDecodedPlain(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("BODY", 222, "1 <a@b> body",
+		"Just some text.")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, r, err := cli.ArticleDecoded("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" || string(got) != "Just some text.\n" {
+		t.Fatalf("Got name=%q body=%q", name, got)
+	}
+}
+
+func TestYencTruncated(t *testing.T) {
+	stub := NewStub(200, "Stub")
+	stub.PrepareDotPayloadResponse("BODY", 222, "1 <a@b> body",
+		"=ybegin line=128 size=3 name=x", "kkk")
+	cli, err := NewConn(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, r, err := cli.ArticleDecoded("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/textproto"
+	"strings"
 	"time"
 )
 
@@ -34,16 +35,74 @@ type Group struct {
 	Posting     PostingStatus
 }
 
+// Estimated returns the article count implied by the group's
+// watermarks (high - low + 1).
+//
+// Both LIST ACTIVE ("name high low status", RFC 3977 7.6.3) and GROUP
+// ("count low high name") only give an estimate, since articles may
+// have been removed from within the range.
+func (g *Group) Estimated() int64 {
+	if g.High < g.Low {
+		return 0
+	}
+	return g.High - g.Low + 1
+}
+
 type ArticleOverview struct {
+	// The article number.  Though unsigned, it's always within the
+	// int64 range used for article numbers elsewhere.
 	Id uint64
 	Subject string
 	From string
 	XRef string
+	// The server name from the Xref, when split from XRef (see the
+	// client's SplitXRefHost setting).
+	XRefHost string
 	Date time.Time
 	MessageId string
 	References string
 	Bytes uint32
 	Lines uint32
+	// Other headers the server's overview format lists as full
+	// fields, keyed by header name.  Nil if there are none.
+	Extra map[string]string
+}
+
+// stripHeaderName removes a leading "Name: " from v, ignoring case, as
+// servers include in overview fields listed as full.
+func stripHeaderName(name, v string) string {
+	if len(v) > len(name) && v[len(name)] == ':' && strings.EqualFold(v[:len(name)], name) {
+		return strings.TrimLeft(v[len(name)+1:], " \t")
+	}
+	return v
+}
+
+// SubjectClean returns the Subject without any "Subject: " prefix.
+func (a *ArticleOverview) SubjectClean() string {
+	return stripHeaderName("Subject", a.Subject)
+}
+
+// FromClean returns the From without any "From: " prefix.
+func (a *ArticleOverview) FromClean() string {
+	return stripHeaderName("From", a.From)
+}
+
+// XRefClean returns the XRef without any "Xref: " prefix.
+func (a *ArticleOverview) XRefClean() string {
+	return stripHeaderName("Xref", a.XRef)
+}
+
+// IsControl guesses whether the overview is of a control message (such
+// as a cancel or newgroup), so readers can hide them.  Overview data
+// doesn't include the Control header, so this goes by the conventions:
+// a Subject of "cmsg " followed by the control command (RFC 5537),
+// or the older "cancel <message-id>", or a Message-ID of the
+// "<cancel.original-id>" form that cancel generators use.
+func (a *ArticleOverview) IsControl() bool {
+	subj := strings.ToLower(a.SubjectClean())
+	return strings.HasPrefix(subj, "cmsg ") ||
+		strings.HasPrefix(subj, "cancel <") ||
+		strings.HasPrefix(a.MessageId, "<cancel.")
 }
 
 // An Article that may appear in one or more groups.
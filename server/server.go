@@ -178,7 +178,7 @@ func (s *Server) Process(nc net.Conn) {
 				// Drop this connection silently. They hung up
 				return
 			case isNNTPError:
-				c.PrintfLine(err.Error())
+				c.PrintfLine("%s", err.Error())
 			default:
 				log.Printf("Error dispatching command, dropping conn: %v",
 					err)